@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 聚合参数
+const (
+	defaultPathDepth = 4 // /storage/emulated/0/<目录>
+	maxTrackedPaths  = 4096
+)
+
+// aggregateDims 可用于分组的维度
+var aggregateDims = map[string]bool{
+	"pkg": true, "op": true, "decision": true, "result": true, "proc": true, "path": true, "hour": true,
+}
+
+// AggregateSpec 聚合方式
+//
+// GroupBy 可包含 pkg、op、decision、result、proc、path（按 PathDepth 截取前缀）
+// 与 hour（本地时间整点）；为空时所有条目合并为一组。
+type AggregateSpec struct {
+	GroupBy   []string
+	PathDepth int
+	TopN      int
+}
+
+// Validate 校验分组维度
+func (spec *AggregateSpec) Validate() error {
+	seen := make(map[string]bool)
+	for _, dim := range spec.GroupBy {
+		if !aggregateDims[dim] {
+			return fmt.Errorf("unknown groupBy dimension %q", dim)
+		}
+		if seen[dim] {
+			return fmt.Errorf("duplicate groupBy dimension %q", dim)
+		}
+		seen[dim] = true
+	}
+	if spec.PathDepth < 0 {
+		return fmt.Errorf("pathDepth must not be negative")
+	}
+	return nil
+}
+
+// PathCount 路径访问次数
+type PathCount struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"`
+}
+
+// AggregateGroup 一个分组的统计结果
+type AggregateGroup struct {
+	Key       map[string]string `json:"key"`
+	Count     int               `json:"count"`
+	FirstSeen int64             `json:"firstSeen"`
+	LastSeen  int64             `json:"lastSeen"`
+	TopPaths  []PathCount       `json:"topPaths,omitempty"`
+
+	paths map[string]int
+}
+
+// Aggregate 扫描匹配条目并按维度分组统计，返回按事件数降序的分组与匹配的事件总数
+//
+// 去重合并或限流汇总的条目按其 count 计入。
+func (l *Logger) Aggregate(filter LogFilter, spec AggregateSpec) ([]AggregateGroup, int, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, 0, err
+	}
+	if spec.PathDepth == 0 {
+		spec.PathDepth = defaultPathDepth
+	}
+
+	l.Flush()
+
+	groups := make(map[string]*AggregateGroup)
+	total := 0
+	err := l.store.Scan(&filter, func(e *LogEntry) bool {
+		n := e.events()
+		total += n
+
+		values := make([]string, len(spec.GroupBy))
+		for i, dim := range spec.GroupBy {
+			values[i] = dimensionValue(e, dim, spec.PathDepth)
+		}
+		id := strings.Join(values, "\x00")
+
+		g, ok := groups[id]
+		if !ok {
+			g = &AggregateGroup{
+				Key:       make(map[string]string, len(values)),
+				FirstSeen: e.Ts,
+				LastSeen:  e.Ts,
+				paths:     make(map[string]int),
+			}
+			for i, dim := range spec.GroupBy {
+				g.Key[dim] = values[i]
+			}
+			groups[id] = g
+		}
+
+		g.Count += n
+		first, last := e.Ts, e.Ts
+		if e.Count > 0 {
+			first, last = e.FirstTs, e.LastTs
+		}
+		if first < g.FirstSeen {
+			g.FirstSeen = first
+		}
+		if last > g.LastSeen {
+			g.LastSeen = last
+		}
+		// 路径过多时不再记录新路径，已记录的路径继续计数
+		if spec.TopN > 0 {
+			if _, ok := g.paths[e.Path]; ok || len(g.paths) < maxTrackedPaths {
+				g.paths[e.Path] += n
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	result := make([]AggregateGroup, 0, len(groups))
+	for _, g := range groups {
+		if spec.TopN > 0 {
+			g.TopPaths = topPaths(g.paths, spec.TopN)
+		}
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].LastSeen > result[j].LastSeen
+	})
+	return result, total, nil
+}
+
+// dimensionValue 返回条目在某个维度上的取值
+func dimensionValue(e *LogEntry, dim string, depth int) string {
+	switch dim {
+	case "pkg":
+		return e.Pkg
+	case "op":
+		return e.Op
+	case "decision":
+		return e.Decision
+	case "result":
+		return e.Result
+	case "proc":
+		return e.Proc
+	case "path":
+		return pathPrefix(e.Path, depth)
+	case "hour":
+		return time.UnixMilli(e.Ts).Format("2006-01-02 15:00")
+	}
+	return ""
+}
+
+// pathPrefix 截取路径的前 depth 级
+func pathPrefix(path string, depth int) string {
+	if !strings.HasPrefix(path, "/") {
+		return path
+	}
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	if len(parts) <= depth {
+		return path
+	}
+	return "/" + strings.Join(parts[:depth], "/")
+}
+
+func topPaths(paths map[string]int, n int) []PathCount {
+	result := make([]PathCount, 0, len(paths))
+	for p, c := range paths {
+		result = append(result, PathCount{Path: p, Count: c})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Path < result[j].Path
+	})
+	if len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
@@ -0,0 +1,587 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// alertsFileName 告警记录文件，与访问日志位于同一目录
+const alertsFileName = "alerts.jsonl"
+
+// 告警参数
+const (
+	maxAlertRules        = 64
+	maxAlertRecords      = 500 // 内存与文件中保留的告警记录数
+	defaultAlertWindowMs = 60000
+	alertCommandTimeout  = 10 * time.Second
+	alertCommandSlots    = 4 // 同时执行的告警命令数
+)
+
+// AlertRule 告警规则：同一应用在窗口内匹配的事件数达到阈值时产生一条告警
+type AlertRule struct {
+	ID         string   `json:"id"`
+	Disabled   bool     `json:"disabled,omitempty"`
+	Pkg        string   `json:"pkg,omitempty"` // 为空时匹配所有应用
+	Ops        []string `json:"ops,omitempty"`
+	Decisions  []string `json:"decisions,omitempty"`
+	Path       string   `json:"path,omitempty"`       // 路径通配，语法与 where 表达式中的 path~ 相同
+	Threshold  int      `json:"threshold"`            // 窗口内的事件数，默认 1
+	WindowMs   int      `json:"windowMs"`             // 默认 60000
+	CooldownMs int      `json:"cooldownMs,omitempty"` // 告警后同一应用不再计数的时间，默认等于 windowMs
+	Message    string   `json:"message,omitempty"`    // 支持 {rule} {pkg} {count} {op} {path} {decision}
+	Command    []string `json:"command,omitempty"`    // 告警时以 root 执行的本地命令，告警内容通过 SR_ALERT_* 环境变量传入；只有 root 客户端可以设置
+}
+
+// changedAlertCommand 返回 rules 中命令与 current 里同 ID 规则不同的第一条规则的下标，
+// 没有时返回 -1；新增的带命令规则也视为修改
+func changedAlertCommand(current, rules []AlertRule) int {
+	commands := make(map[string][]string, len(current))
+	for _, r := range current {
+		commands[r.ID] = r.Command
+	}
+	for i, r := range rules {
+		if len(r.Command) > 0 && !slices.Equal(r.Command, commands[r.ID]) {
+			return i
+		}
+	}
+	return -1
+}
+
+func validateAlertRules(rules []AlertRule) error {
+	if len(rules) > maxAlertRules {
+		return fmt.Errorf("alerts must not contain more than %d rules", maxAlertRules)
+	}
+	ids := make(map[string]bool)
+	for i := range rules {
+		r := &rules[i]
+		if r.ID == "" {
+			return fmt.Errorf("alerts[%d].id is required", i)
+		}
+		if ids[r.ID] {
+			return fmt.Errorf("alerts[%d].id %q is duplicated", i, r.ID)
+		}
+		ids[r.ID] = true
+
+		if r.Threshold == 0 {
+			r.Threshold = 1
+		}
+		if r.WindowMs == 0 {
+			r.WindowMs = defaultAlertWindowMs
+		}
+		if r.Threshold < 1 || r.Threshold > 100000 {
+			return fmt.Errorf("alerts[%d].threshold must be between 1 and 100000", i)
+		}
+		if r.WindowMs < 1000 || r.WindowMs > 24*3600*1000 {
+			return fmt.Errorf("alerts[%d].windowMs must be between 1000 and 86400000", i)
+		}
+		if r.CooldownMs < 0 || r.CooldownMs > 24*3600*1000 {
+			return fmt.Errorf("alerts[%d].cooldownMs must be between 0 and 86400000", i)
+		}
+		if r.Path != "" {
+			if _, err := globToRegexp(r.Path); err != nil {
+				return fmt.Errorf("alerts[%d].path is invalid: %v", i, err)
+			}
+		}
+		if len(r.Command) > 0 && r.Command[0] == "" {
+			return fmt.Errorf("alerts[%d].command[0] must not be empty", i)
+		}
+	}
+	return nil
+}
+
+// compiledAlertRule 已编译的告警规则
+type compiledAlertRule struct {
+	AlertRule
+	filter   LogFilter
+	path     *regexp.Regexp
+	window   int64
+	cooldown int64
+}
+
+func compileAlertRule(r AlertRule) (compiledAlertRule, error) {
+	c := compiledAlertRule{
+		AlertRule: r,
+		filter:    LogFilter{Pkg: r.Pkg, Ops: r.Ops, Decisions: r.Decisions},
+	}
+	if c.Threshold <= 0 {
+		c.Threshold = 1
+	}
+	if c.WindowMs <= 0 {
+		c.WindowMs = defaultAlertWindowMs
+	}
+	c.window = int64(c.WindowMs)
+	c.cooldown = int64(c.CooldownMs)
+	if c.cooldown == 0 {
+		c.cooldown = c.window
+	}
+	if r.Path != "" {
+		re, err := globToRegexp(r.Path)
+		if err != nil {
+			return c, err
+		}
+		c.path = re
+	}
+	return c, nil
+}
+
+func (r *compiledAlertRule) match(e *LogEntry) bool {
+	if !r.filter.Match(e) {
+		return false
+	}
+	return r.path == nil || r.path.MatchString(e.Path)
+}
+
+// alertWindow 某条规则下某个应用的计数窗口
+type alertWindow struct {
+	ts            []int64 // 窗口内匹配事件的到达时间
+	cooldownUntil int64
+}
+
+// AlertRecord 一条告警
+type AlertRecord struct {
+	ID       int64    `json:"id"`
+	Ts       int64    `json:"ts"`
+	Rule     string   `json:"rule"`
+	Pkg      string   `json:"pkg"`
+	Count    int      `json:"count"`
+	WindowMs int      `json:"windowMs"`
+	FirstTs  int64    `json:"firstTs"`
+	LastTs   int64    `json:"lastTs"`
+	Message  string   `json:"message"`
+	Sample   LogEntry `json:"sample"` // 触发告警的条目
+}
+
+// AlertFilter alert.list / alert.follow 查询条件
+type AlertFilter struct {
+	Rule  string
+	Pkg   string
+	Since int64
+}
+
+func (f *AlertFilter) match(r *AlertRecord) bool {
+	if f.Rule != "" && r.Rule != f.Rule {
+		return false
+	}
+	if f.Pkg != "" && r.Pkg != f.Pkg {
+		return false
+	}
+	return f.Since <= 0 || r.Ts >= f.Since
+}
+
+// AlertSubscription 告警订阅，新告警推入队列，队列满时丢弃
+type AlertSubscription struct {
+	ID      int64
+	ch      chan AlertRecord
+	dropped atomic.Int64
+}
+
+// C 返回告警队列
+func (sub *AlertSubscription) C() <-chan AlertRecord {
+	return sub.ch
+}
+
+// Dropped 返回因队列已满而丢弃的告警数
+func (sub *AlertSubscription) Dropped() int64 {
+	return sub.dropped.Load()
+}
+
+// AlertManager 在 Logger.Write 中按规则统计访问事件并产生告警
+//
+// 告警记录追加到 alerts.jsonl 并保留最近 maxAlertRecords 条，同时推送给
+// alert.follow 订阅者，规则配置了 command 时在后台执行。
+type AlertManager struct {
+	path string
+	dlog *DaemonLog
+
+	mu        sync.Mutex
+	rules     []compiledAlertRule
+	windows   map[string]*alertWindow // 规则 ID + 应用 -> 窗口
+	records   []AlertRecord           // 按时间升序
+	nextID    int64
+	file      *os.File
+	fileLines int
+	fired     int64
+	lastError string
+
+	cmdSlots    chan struct{}
+	cmdRuns     atomic.Int64
+	cmdFailures atomic.Int64
+	cmdSkipped  atomic.Int64
+
+	subMu     sync.RWMutex
+	subs      map[int64]*AlertSubscription
+	nextSubID int64
+}
+
+// openAlertManager 加载日志目录下已有的告警记录
+func openAlertManager(dir string, dlog *DaemonLog) (*AlertManager, error) {
+	m := &AlertManager{
+		path:     filepath.Join(dir, alertsFileName),
+		dlog:     dlog,
+		windows:  make(map[string]*alertWindow),
+		cmdSlots: make(chan struct{}, alertCommandSlots),
+		subs:     make(map[int64]*AlertSubscription),
+	}
+
+	records, lines, err := readAlertRecords(m.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(records) > maxAlertRecords {
+		records = records[len(records)-maxAlertRecords:]
+	}
+	m.records = records
+	if len(records) > 0 {
+		m.nextID = records[len(records)-1].ID
+	}
+
+	// 文件中的记录多于保留数（或有损坏的行）时重写
+	if lines > len(records) {
+		if err := m.rewriteLocked(); err != nil {
+			return nil, err
+		}
+	} else {
+		m.fileLines = lines
+	}
+	return m, nil
+}
+
+// readAlertRecords 读取告警记录，同时返回文件行数
+func readAlertRecords(path string) ([]AlertRecord, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	var records []AlertRecord
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lines++
+		var r AlertRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			continue
+		}
+		records = append(records, r)
+	}
+	return records, lines, scanner.Err()
+}
+
+// rewriteLocked 用内存中保留的记录重写告警文件
+func (m *AlertManager) rewriteLocked() error {
+	if m.file != nil {
+		m.file.Close()
+		m.file = nil
+	}
+
+	tmp := m.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for i := range m.records {
+		data, _ := json.Marshal(&m.records[i])
+		w.Write(data)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	f.Close()
+	if err := os.Rename(tmp, m.path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	m.fileLines = len(m.records)
+	return nil
+}
+
+// appendLocked 保存一条告警记录
+func (m *AlertManager) appendLocked(rec *AlertRecord) {
+	m.records = append(m.records, *rec)
+	if len(m.records) > maxAlertRecords {
+		m.records = append(m.records[:0], m.records[len(m.records)-maxAlertRecords:]...)
+	}
+
+	if m.fileLines >= 2*maxAlertRecords {
+		if err := m.rewriteLocked(); err != nil {
+			m.lastError = err.Error()
+		}
+		return
+	}
+	if m.file == nil {
+		f, err := os.OpenFile(m.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			m.lastError = err.Error()
+			return
+		}
+		m.file = f
+	}
+	data, _ := json.Marshal(rec)
+	data = append(data, '\n')
+	if _, err := m.file.Write(data); err != nil {
+		m.lastError = err.Error()
+		return
+	}
+	m.fileLines++
+}
+
+// SetRules 替换告警规则，所有计数窗口重新开始
+func (m *AlertManager) SetRules(rules []AlertRule) {
+	compiled := make([]compiledAlertRule, 0, len(rules))
+	for _, r := range rules {
+		if r.Disabled {
+			continue
+		}
+		c, err := compileAlertRule(r)
+		if err != nil {
+			m.dlog.Log("warn", "alert", "Skipping alert rule %s: %v", r.ID, err)
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules = compiled
+	m.windows = make(map[string]*alertWindow)
+}
+
+// Evaluate 按规则统计一条新到达的事件，达到阈值时产生告警
+func (m *AlertManager) Evaluate(e *LogEntry, now time.Time) {
+	m.mu.Lock()
+	if len(m.rules) == 0 {
+		m.mu.Unlock()
+		return
+	}
+
+	arrived := now.UnixMilli()
+	var fired []AlertRecord
+	var commands [][]string
+	for i := range m.rules {
+		r := &m.rules[i]
+		if !r.match(e) {
+			continue
+		}
+
+		key := r.ID + "\x00" + e.Pkg
+		w, ok := m.windows[key]
+		if !ok {
+			w = &alertWindow{}
+			m.windows[key] = w
+		}
+		if arrived < w.cooldownUntil {
+			continue
+		}
+
+		w.ts = append(w.ts, arrived)
+		cut := 0
+		for cut < len(w.ts) && w.ts[cut] <= arrived-r.window {
+			cut++
+		}
+		w.ts = w.ts[cut:]
+		if len(w.ts) < r.Threshold {
+			continue
+		}
+
+		m.nextID++
+		rec := AlertRecord{
+			ID:       m.nextID,
+			Ts:       arrived,
+			Rule:     r.ID,
+			Pkg:      e.Pkg,
+			Count:    len(w.ts),
+			WindowMs: r.WindowMs,
+			FirstTs:  w.ts[0],
+			LastTs:   arrived,
+			Sample:   *e,
+		}
+		rec.Message = alertMessage(r, &rec)
+		w.ts = nil
+		w.cooldownUntil = arrived + r.cooldown
+
+		m.appendLocked(&rec)
+		m.fired++
+		fired = append(fired, rec)
+		commands = append(commands, r.Command)
+	}
+	m.mu.Unlock()
+
+	for i := range fired {
+		m.dlog.Log("warn", "alert", "%s", fired[i].Message)
+		m.publish(&fired[i])
+		if len(commands[i]) > 0 {
+			m.runCommand(commands[i], fired[i])
+		}
+	}
+}
+
+// alertMessage 生成告警消息
+func alertMessage(r *compiledAlertRule, rec *AlertRecord) string {
+	if r.Message == "" {
+		return fmt.Sprintf("[%s] %s: %d events within %ds (last: %s %s %s)",
+			rec.Rule, rec.Pkg, rec.Count, r.WindowMs/1000, rec.Sample.Op, rec.Sample.Path, rec.Sample.Decision)
+	}
+	return strings.NewReplacer(
+		"{rule}", rec.Rule,
+		"{pkg}", rec.Pkg,
+		"{count}", strconv.Itoa(rec.Count),
+		"{op}", rec.Sample.Op,
+		"{path}", rec.Sample.Path,
+		"{decision}", rec.Sample.Decision,
+	).Replace(r.Message)
+}
+
+// runCommand 在后台执行告警命令；正在执行的命令过多时跳过
+func (m *AlertManager) runCommand(argv []string, rec AlertRecord) {
+	select {
+	case m.cmdSlots <- struct{}{}:
+	default:
+		m.cmdSkipped.Add(1)
+		m.dlog.Log("warn", "alert", "Too many alert commands running, skipped command for alert %d", rec.ID)
+		return
+	}
+
+	go func() {
+		defer func() { <-m.cmdSlots }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), alertCommandTimeout)
+		defer cancel()
+
+		data, _ := json.Marshal(&rec)
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Env = append(os.Environ(),
+			"SR_ALERT_ID="+strconv.FormatInt(rec.ID, 10),
+			"SR_ALERT_RULE="+rec.Rule,
+			"SR_ALERT_PKG="+rec.Pkg,
+			"SR_ALERT_COUNT="+strconv.Itoa(rec.Count),
+			"SR_ALERT_OP="+rec.Sample.Op,
+			"SR_ALERT_PATH="+rec.Sample.Path,
+			"SR_ALERT_DECISION="+rec.Sample.Decision,
+			"SR_ALERT_MESSAGE="+rec.Message,
+			"SR_ALERT_JSON="+string(data),
+		)
+
+		m.cmdRuns.Add(1)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			m.cmdFailures.Add(1)
+			m.dlog.Log("error", "alert", "Alert command for rule %s failed: %v: %s",
+				rec.Rule, err, strings.TrimSpace(string(out)))
+		}
+	}()
+}
+
+// List 返回最近 limit 条匹配的告警（按时间降序），同时返回匹配总数
+func (m *AlertManager) List(filter AlertFilter, limit int) ([]AlertRecord, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result := []AlertRecord{}
+	total := 0
+	for i := len(m.records) - 1; i >= 0; i-- {
+		if !filter.match(&m.records[i]) {
+			continue
+		}
+		total++
+		if len(result) < limit {
+			result = append(result, m.records[i])
+		}
+	}
+	return result, total
+}
+
+// Subscribe 订阅新产生的告警
+func (m *AlertManager) Subscribe(queueSize int) *AlertSubscription {
+	if queueSize <= 0 {
+		queueSize = defaultFollowQueue
+	}
+	if queueSize > maxFollowQueue {
+		queueSize = maxFollowQueue
+	}
+
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+
+	m.nextSubID++
+	sub := &AlertSubscription{
+		ID: m.nextSubID,
+		ch: make(chan AlertRecord, queueSize),
+	}
+	m.subs[sub.ID] = sub
+	return sub
+}
+
+// Unsubscribe 取消订阅
+func (m *AlertManager) Unsubscribe(sub *AlertSubscription) {
+	m.subMu.Lock()
+	defer m.subMu.Unlock()
+	delete(m.subs, sub.ID)
+}
+
+// publish 将告警推送给所有订阅者（不阻塞）
+func (m *AlertManager) publish(rec *AlertRecord) {
+	m.subMu.RLock()
+	defer m.subMu.RUnlock()
+
+	for _, sub := range m.subs {
+		select {
+		case sub.ch <- *rec:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Status 返回规则数、告警数与命令执行情况（对应 status.alerts）
+func (m *AlertManager) Status() map[string]interface{} {
+	m.subMu.RLock()
+	followers := len(m.subs)
+	m.subMu.RUnlock()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := map[string]interface{}{
+		"rules":     len(m.rules),
+		"fired":     m.fired,
+		"stored":    len(m.records),
+		"followers": followers,
+		"commands": map[string]interface{}{
+			"runs":     m.cmdRuns.Load(),
+			"failures": m.cmdFailures.Load(),
+			"skipped":  m.cmdSkipped.Load(),
+		},
+	}
+	if m.lastError != "" {
+		status["lastError"] = m.lastError
+	}
+	return status
+}
+
+// Close 关闭告警文件
+func (m *AlertManager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.file != nil {
+		m.file.Close()
+		m.file = nil
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// 归属方式枚举
+const (
+	AttrDirect       = "DIRECT"        // 进程名即包名（主进程）
+	AttrSameUid      = "SAME_UID"      // 同 uid 的其他进程
+	AttrSharedUid    = "SHARED_UID"    // sharedUserId，多个包共用 uid
+	AttrIsolated     = "ISOLATED"      // isolated / app zygote 派生进程继承宿主
+	AttrChildProcess = "CHILD_PROCESS" // 沿父进程链继承
+	AttrSystem       = "SYSTEM"        // 系统 uid，不属于任何应用
+	AttrUnknown      = "UNKNOWN"
+)
+
+// 归属结果策略：命中包且继承规则时为 applyRules，否则为 allow；未知时为 fallbackUnknownPolicy
+const (
+	PolicyApplyRules  = "applyRules"
+	PolicyAllow       = "allow"
+	PolicyMonitorOnly = "monitorOnly"
+)
+
+// maxParentDepth 各模式下沿父进程链回溯的最大层数
+var maxParentDepth = map[string]int{
+	"strict":   8,
+	"balanced": 1,
+	"relaxed":  0,
+}
+
+// AttributionStep 归属推断链中的一步
+type AttributionStep struct {
+	Pid    int    `json:"pid"`
+	Proc   string `json:"proc"`
+	Uid    int    `json:"uid"`
+	Reason string `json:"reason"`
+}
+
+// Attribution 进程归属结果
+type Attribution struct {
+	Pid            int               `json:"pid,omitempty"`
+	Uid            int               `json:"uid"`
+	Proc           string            `json:"proc,omitempty"`
+	Mode           string            `json:"mode"`
+	PackageName    string            `json:"packageName"`
+	Method         string            `json:"method"`
+	Chain          []AttributionStep `json:"chain,omitempty"`
+	Inherits       bool              `json:"inherits"`
+	HasRules       bool              `json:"hasRules"`
+	Policy         string            `json:"policy"`
+	Tag            string            `json:"tag,omitempty"`
+	RuleSetVersion int               `json:"ruleSetVersion"`
+}
+
+// Attributor 根据 ProcessAttrConfig 决定进程应用哪个包的规则
+//
+// strict：启用的继承开关全部生效，沿父进程链回溯，共享 uid 也会归属；
+// balanced：isolated 仅在能证明由 app zygote 派生时继承，只看直接父进程，
+// 共享 uid 无法区分时不归属，未知进程的拒写策略降级为仅监控；
+// relaxed：只做进程名与同 uid 归属，未知进程放行。
+type Attributor struct {
+	resolver      *ProcResolver
+	configManager *ConfigManager
+}
+
+// NewAttributor 创建归属引擎
+func NewAttributor(resolver *ProcResolver, cm *ConfigManager) *Attributor {
+	return &Attributor{
+		resolver:      resolver,
+		configManager: cm,
+	}
+}
+
+// AttributePid 对指定进程做归属判断
+func (a *Attributor) AttributePid(pid int) (*Attribution, error) {
+	info, err := a.resolver.Resolve(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := a.configManager.GetGlobalConfig().ProcessAttr
+	result := &Attribution{
+		Pid:  info.Pid,
+		Uid:  info.Uid,
+		Proc: info.Proc,
+		Mode: cfg.Mode,
+	}
+
+	a.attributeProcess(result, info, cfg)
+	a.finish(result, cfg)
+	return result, nil
+}
+
+// AttributeUid 仅根据 uid 做归属判断（无法使用进程名与父进程信息）
+func (a *Attributor) AttributeUid(uid int) (*Attribution, error) {
+	if uid < 0 {
+		return nil, fmt.Errorf("invalid uid %d", uid)
+	}
+
+	cfg := a.configManager.GetGlobalConfig().ProcessAttr
+	result := &Attribution{
+		Uid:  uid,
+		Mode: cfg.Mode,
+	}
+
+	appId := uid % perUserRange
+	switch {
+	case isApplicationAppId(appId):
+		pkgs := a.resolver.PackagesForAppId(appId)
+		switch {
+		case len(pkgs) == 1:
+			result.PackageName = pkgs[0]
+			result.Method = AttrSameUid
+			result.Inherits = cfg.InheritToAllSameUid
+		case len(pkgs) > 1 && cfg.Mode == "strict":
+			result.PackageName = pkgs[0]
+			result.Method = AttrSharedUid
+			result.Inherits = cfg.InheritToAllSameUid
+		}
+	case appId < firstApplicationUid:
+		result.Method = AttrSystem
+	}
+
+	a.finish(result, cfg)
+	return result, nil
+}
+
+// attributeProcess 按模式与继承开关归属单个进程，必要时沿父进程链回溯
+func (a *Attributor) attributeProcess(result *Attribution, info *ProcessInfo, cfg ProcessAttrConfig) {
+	pkg, method, inherits := a.attributeSelf(info, cfg)
+	switch {
+	case pkg != "":
+		result.PackageName = pkg
+		result.Method = method
+		result.Inherits = inherits
+		result.Chain = append(result.Chain, stepOf(info, method))
+		if inherits {
+			return
+		}
+	case !isApplicationAppId(info.AppId) && !info.IsIsolated && !isAppZygoteIsolatedAppId(info.AppId):
+		result.Method = AttrSystem
+		result.Chain = append(result.Chain, stepOf(info, AttrSystem))
+		return
+	default:
+		result.Method = AttrUnknown
+		result.Chain = append(result.Chain, stepOf(info, AttrUnknown))
+	}
+
+	if !cfg.InheritToChildProcess {
+		return
+	}
+
+	// 自身无法继承规则时沿父进程链回溯，直到 zygote 或达到模式允许的深度
+	current := info
+	for depth := 0; depth < maxParentDepth[cfg.Mode]; depth++ {
+		if current.PPid <= 1 || isZygoteName(current.ParentProc) {
+			break
+		}
+		parent, err := a.resolver.Resolve(current.PPid)
+		if err != nil {
+			break
+		}
+		if pkg, _, inherits := a.attributeSelf(parent, cfg); pkg != "" && inherits {
+			result.PackageName = pkg
+			result.Method = AttrChildProcess
+			result.Inherits = true
+			result.Chain = append(result.Chain, stepOf(parent, AttrChildProcess))
+			return
+		}
+		result.Chain = append(result.Chain, stepOf(parent, AttrUnknown))
+		current = parent
+	}
+}
+
+// attributeSelf 仅根据进程自身信息归属（不回溯父进程链）
+//
+// 返回归属的包名、归属方式，以及按继承开关是否应用该包的规则。
+func (a *Attributor) attributeSelf(info *ProcessInfo, cfg ProcessAttrConfig) (string, string, bool) {
+	switch info.ResolutionReason {
+	case ReasonByUidPrimary, ReasonByUidShared, ReasonByProcName:
+		if info.IsIsolated || isAppZygoteIsolatedAppId(info.AppId) {
+			// 仅凭进程名推断 isolated 进程归属只在 strict 模式下进行
+			if cfg.Mode != "strict" {
+				return "", "", false
+			}
+			return info.PackageName, AttrIsolated, cfg.InheritToIsolated
+		}
+		if info.Proc == info.PackageName {
+			return info.PackageName, AttrDirect, true
+		}
+		if info.ResolutionReason == ReasonByUidShared {
+			// 共享 uid 下进程名无法对应到具体包时，只有 strict 模式才归属
+			if !procBelongsTo(info.Proc, info.PackageName) && cfg.Mode != "strict" {
+				return "", "", false
+			}
+			return info.PackageName, AttrSharedUid, cfg.InheritToAllSameUid
+		}
+		return info.PackageName, AttrSameUid, cfg.InheritToAllSameUid
+
+	case ReasonByAppZygote:
+		return info.PackageName, AttrIsolated, cfg.InheritToIsolated && cfg.Mode != "relaxed"
+	}
+
+	return "", "", false
+}
+
+// finish 根据归属结果决定最终策略
+func (a *Attributor) finish(result *Attribution, cfg ProcessAttrConfig) {
+	result.RuleSetVersion = a.configManager.GetVersion()
+
+	switch {
+	case result.PackageName != "":
+		app, ok := a.configManager.GetEffectiveAppConfig(result.PackageName, time.Now())
+		result.HasRules = ok && app.Enabled &&
+			(len(app.RedirectRules) > 0 || len(app.ReadOnlyRules) > 0)
+		result.Policy = PolicyAllow
+		if result.HasRules && result.Inherits {
+			result.Policy = PolicyApplyRules
+		}
+	case result.Method == AttrSystem:
+		result.Policy = PolicyAllow
+	default:
+		result.Method = AttrUnknown
+		result.Policy = fallbackPolicy(cfg)
+		if cfg.DiagnosticTagUnknown {
+			result.Tag = "UNKNOWN_ATTRIBUTION"
+		}
+	}
+}
+
+// fallbackPolicy 返回未知归属进程在当前模式下的策略
+func fallbackPolicy(cfg ProcessAttrConfig) string {
+	switch cfg.Mode {
+	case "relaxed":
+		return PolicyAllow
+	case "balanced":
+		if cfg.FallbackUnknownPolicy == "denyWriteOnMatchedPaths" {
+			return PolicyMonitorOnly
+		}
+	}
+	return cfg.FallbackUnknownPolicy
+}
+
+func stepOf(info *ProcessInfo, reason string) AttributionStep {
+	return AttributionStep{
+		Pid:    info.Pid,
+		Proc:   info.Proc,
+		Uid:    info.Uid,
+		Reason: reason,
+	}
+}
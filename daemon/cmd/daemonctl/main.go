@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -71,6 +72,16 @@ func main() {
 		resp, err = handleLogCmd(socketPath, os.Args[2:])
 	case "diag", "d":
 		resp, err = handleDiagCmd(socketPath, os.Args[2:])
+	case "proc":
+		resp, err = handleProcCmd(socketPath, os.Args[2:])
+	case "runtime":
+		resp, err = handleRuntimeCmd(socketPath, os.Args[2:])
+	case "alert":
+		resp, err = handleAlertCmd(socketPath, os.Args[2:])
+	case "daemon":
+		resp, err = handleDaemonCmd(socketPath, os.Args[2:])
+	case "report":
+		resp, err = handleReportCmd(socketPath, os.Args[2:])
 	default:
 		fmt.Fprintf(os.Stderr, "未知命令: %s\n", cmd)
 		printUsage()
@@ -200,7 +211,7 @@ func handleGlobalCmd(socketPath string, args []string) (*Response, error) {
 
 func handleAppCmd(socketPath string, args []string) (*Response, error) {
 	if len(args) < 1 {
-		fmt.Fprintf(os.Stderr, "用法: daemonctl app <get|set|list|delete> [--pkg <package>] [--json '<json>'] [--json-base64 '<base64>']\n")
+		fmt.Fprintf(os.Stderr, "用法: daemonctl app <get|set|list|delete|suspend|override|restore|overrides> [--pkg <package>] [--json '<json>'] [--json-base64 '<base64>'] [--duration <ms>] [--ttl <ms>]\n")
 		os.Exit(2)
 	}
 
@@ -215,6 +226,18 @@ func handleAppCmd(socketPath string, args []string) (*Response, error) {
 				params["pkg"] = args[i+1]
 				i++
 			}
+		case "--duration":
+			if i+1 < len(args) {
+				n, _ := strconv.ParseInt(args[i+1], 10, 64)
+				params["durationMs"] = n
+				i++
+			}
+		case "--ttl":
+			if i+1 < len(args) {
+				n, _ := strconv.ParseInt(args[i+1], 10, 64)
+				params["ttlMs"] = n
+				i++
+			}
 		case "--json", "-j":
 			if i+1 < len(args) {
 				var app map[string]interface{}
@@ -265,6 +288,38 @@ func handleAppCmd(socketPath string, args []string) (*Response, error) {
 			os.Exit(2)
 		}
 		return sendCommand(socketPath, "app.delete", params)
+	case "suspend":
+		if params["pkg"] == nil {
+			fmt.Fprintf(os.Stderr, "缺少 --pkg 参数\n")
+			os.Exit(2)
+		}
+		if params["durationMs"] == nil {
+			fmt.Fprintf(os.Stderr, "缺少 --duration 参数\n")
+			os.Exit(2)
+		}
+		return sendCommand(socketPath, "app.suspend", params)
+	case "override":
+		if params["pkg"] == nil {
+			fmt.Fprintf(os.Stderr, "缺少 --pkg 参数\n")
+			os.Exit(2)
+		}
+		if params["app"] == nil {
+			fmt.Fprintf(os.Stderr, "缺少 --json 参数\n")
+			os.Exit(2)
+		}
+		if params["ttlMs"] == nil {
+			fmt.Fprintf(os.Stderr, "缺少 --ttl 参数\n")
+			os.Exit(2)
+		}
+		return sendCommand(socketPath, "app.override", params)
+	case "restore":
+		if params["pkg"] == nil {
+			fmt.Fprintf(os.Stderr, "缺少 --pkg 参数\n")
+			os.Exit(2)
+		}
+		return sendCommand(socketPath, "app.restore", params)
+	case "overrides":
+		return sendCommand(socketPath, "app.overrides", nil)
 	default:
 		fmt.Fprintf(os.Stderr, "未知子命令: %s\n", subCmd)
 		os.Exit(2)
@@ -274,7 +329,7 @@ func handleAppCmd(socketPath string, args []string) (*Response, error) {
 
 func handleLogCmd(socketPath string, args []string) (*Response, error) {
 	if len(args) < 1 {
-		fmt.Fprintf(os.Stderr, "用法: daemonctl log <tail|query|clear|stats> [--pkg <package>] [options]\n")
+		fmt.Fprintf(os.Stderr, "用法: daemonctl log <tail|query|sessions|clear|delete|redact|stats|follow|top|export|verify|convert> [--pkg <package>] [options]\n")
 		os.Exit(2)
 	}
 
@@ -324,41 +379,145 @@ func handleLogCmd(socketPath string, args []string) (*Response, error) {
 				params["ops"] = []string{args[i+1]}
 				i++
 			}
+		case "--cursor":
+			if i+1 < len(args) {
+				params["cursor"] = args[i+1]
+				i++
+			}
 		case "--contains":
 			if i+1 < len(args) {
 				params["contains"] = args[i+1]
 				i++
 			}
+		case "--decision":
+			if i+1 < len(args) {
+				params["decisions"] = strings.Split(args[i+1], ",")
+				i++
+			}
+		case "--all":
+			params["all"] = true
+		case "--where", "-w":
+			if i+1 < len(args) {
+				params["where"] = args[i+1]
+				i++
+			}
+		case "--by":
+			if i+1 < len(args) {
+				params["by"] = args[i+1]
+				i++
+			}
+		case "--depth":
+			if i+1 < len(args) {
+				n, _ := strconv.Atoi(args[i+1])
+				params["pathDepth"] = n
+				i++
+			}
+		case "--format":
+			if i+1 < len(args) {
+				params["format"] = args[i+1]
+				i++
+			}
+		case "--encoding":
+			if i+1 < len(args) {
+				params["encoding"] = args[i+1]
+				i++
+			}
+		case "--path-prefix":
+			if i+1 < len(args) {
+				params["pathPrefix"] = args[i+1]
+				i++
+			}
+		case "--pattern":
+			if i+1 < len(args) {
+				params["pattern"] = args[i+1]
+				i++
+			}
+		case "--replace":
+			if i+1 < len(args) {
+				params["replace"] = args[i+1]
+				i++
+			}
+		case "--fields":
+			if i+1 < len(args) {
+				params["fields"] = strings.Split(args[i+1], ",")
+				i++
+			}
+		case "--dry-run":
+			params["dryRun"] = true
+		case "--open":
+			params["openOnly"] = true
+		case "--min-bytes":
+			if i+1 < len(args) {
+				n, _ := strconv.ParseInt(args[i+1], 10, 64)
+				params["minBytes"] = n
+				i++
+			}
+		case "--gzip":
+			params["gzip"] = true
+		case "--out", "-o":
+			if i+1 < len(args) {
+				params["out"] = args[i+1]
+				i++
+			}
 		}
 	}
 
 	switch subCmd {
 	case "tail":
-		if params["pkg"] == nil {
-			fmt.Fprintf(os.Stderr, "缺少 --pkg 参数\n")
+		if params["pkg"] == nil && params["all"] == nil {
+			fmt.Fprintf(os.Stderr, "缺少 --pkg 参数（查看所有应用请使用 --all）\n")
 			os.Exit(2)
 		}
+		delete(params, "all")
 		if params["n"] == nil {
 			params["n"] = 10
 		}
 		return sendCommand(socketPath, "log.tail", params)
 	case "query":
-		if params["pkg"] == nil {
-			fmt.Fprintf(os.Stderr, "缺少 --pkg 参数\n")
+		if params["pkg"] == nil && params["all"] == nil {
+			fmt.Fprintf(os.Stderr, "缺少 --pkg 参数（查询所有应用请使用 --all）\n")
 			os.Exit(2)
 		}
+		delete(params, "all")
 		if params["limit"] == nil {
 			params["limit"] = 100
 		}
 		return sendCommand(socketPath, "log.query", params)
 	case "clear":
-		if params["pkg"] == nil {
-			fmt.Fprintf(os.Stderr, "缺少 --pkg 参数\n")
+		if params["pkg"] == nil && params["all"] == nil {
+			fmt.Fprintf(os.Stderr, "缺少 --pkg 参数（清空所有应用请使用 --all）\n")
+			os.Exit(2)
+		}
+		if params["pkg"] != nil && params["all"] != nil {
+			fmt.Fprintf(os.Stderr, "--pkg 与 --all 不能同时使用\n")
 			os.Exit(2)
 		}
 		return sendCommand(socketPath, "log.clear", params)
+	case "sessions":
+		return sendCommand(socketPath, "log.sessions", params)
+	case "delete":
+		return sendCommand(socketPath, "log.delete", params)
+	case "redact":
+		return sendCommand(socketPath, "log.redact", params)
 	case "stats":
 		return sendCommand(socketPath, "log.stats", nil)
+	case "verify":
+		return sendCommand(socketPath, "log.verify", nil)
+	case "convert":
+		if params["encoding"] == nil {
+			fmt.Fprintf(os.Stderr, "缺少 --encoding 参数（json 或 binary）\n")
+			os.Exit(2)
+		}
+		return sendCommand(socketPath, "log.convert", params)
+	case "follow":
+		followLogs(socketPath, params)
+		return nil, nil
+	case "top":
+		return sendCommand(socketPath, "log.aggregate", topParams(params))
+	case "export":
+		delete(params, "all")
+		exportLogs(socketPath, params)
+		return nil, nil
 	default:
 		fmt.Fprintf(os.Stderr, "未知子命令: %s\n", subCmd)
 		os.Exit(2)
@@ -366,6 +525,39 @@ func handleLogCmd(socketPath string, args []string) (*Response, error) {
 	return nil, nil
 }
 
+// topParams 将 log top 的参数转换为 log.aggregate 请求
+//
+// --by paths（默认）统计访问最多的路径前缀，--by denied 统计被拒绝最多的应用。
+func topParams(params map[string]interface{}) map[string]interface{} {
+	by, _ := params["by"].(string)
+	delete(params, "by")
+	delete(params, "all")
+
+	params["limit"] = 10
+	if n, ok := params["n"]; ok {
+		params["limit"] = n
+		delete(params, "n")
+	}
+
+	switch by {
+	case "", "paths":
+		params["groupBy"] = []string{"path"}
+		params["topN"] = 0
+	case "denied":
+		params["groupBy"] = []string{"pkg"}
+		params["topN"] = 3
+		denied := `decision^="DENY_"`
+		if where, ok := params["where"].(string); ok && where != "" {
+			denied = "(" + where + ") and " + denied
+		}
+		params["where"] = denied
+	default:
+		fmt.Fprintf(os.Stderr, "未知统计方式: %s（可选 paths、denied）\n", by)
+		os.Exit(2)
+	}
+	return params
+}
+
 func handleDiagCmd(socketPath string, args []string) (*Response, error) {
 	if len(args) < 1 {
 		fmt.Fprintf(os.Stderr, "用法: daemonctl diag <whoami> [--pid <pid>]\n")
@@ -396,6 +588,254 @@ func handleDiagCmd(socketPath string, args []string) (*Response, error) {
 	return nil, nil
 }
 
+func handleProcCmd(socketPath string, args []string) (*Response, error) {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "用法: daemonctl proc <attribute|list|refresh> [--pid <pid>] [--uid <uid>] [--pkg <package>]\n")
+		os.Exit(2)
+	}
+
+	subCmd := args[0]
+	params := make(map[string]interface{})
+
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--pid":
+			if i+1 < len(args) {
+				pid, _ := strconv.Atoi(args[i+1])
+				params["pid"] = pid
+				i++
+			}
+		case "--uid":
+			if i+1 < len(args) {
+				uid, _ := strconv.Atoi(args[i+1])
+				params["uid"] = uid
+				i++
+			}
+		case "--pkg", "-p":
+			if i+1 < len(args) {
+				params["pkg"] = args[i+1]
+				i++
+			}
+		}
+	}
+
+	switch subCmd {
+	case "attribute":
+		if params["pid"] == nil && params["uid"] == nil {
+			fmt.Fprintf(os.Stderr, "缺少 --pid 或 --uid 参数\n")
+			os.Exit(2)
+		}
+		return sendCommand(socketPath, "proc.attribute", params)
+	case "list":
+		return sendCommand(socketPath, "proc.list", nil)
+	case "refresh":
+		return sendCommand(socketPath, "proc.refresh", params)
+	default:
+		fmt.Fprintf(os.Stderr, "未知子命令: %s\n", subCmd)
+		os.Exit(2)
+	}
+	return nil, nil
+}
+
+func handleRuntimeCmd(socketPath string, args []string) (*Response, error) {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "用法: daemonctl runtime <stale> [--pkg <package>]\n")
+		os.Exit(2)
+	}
+
+	subCmd := args[0]
+	params := make(map[string]interface{})
+
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--pkg", "-p":
+			if i+1 < len(args) {
+				params["pkg"] = args[i+1]
+				i++
+			}
+		}
+	}
+
+	switch subCmd {
+	case "stale":
+		return sendCommand(socketPath, "runtime.stale", params)
+	default:
+		fmt.Fprintf(os.Stderr, "未知子命令: %s\n", subCmd)
+		os.Exit(2)
+	}
+	return nil, nil
+}
+
+func handleReportCmd(socketPath string, args []string) (*Response, error) {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "用法: daemonctl report paths <--pkg <package>|--all> [--depth <n>] [--from <ms>] [--to <ms>]\n")
+		os.Exit(2)
+	}
+
+	subCmd := args[0]
+	params := make(map[string]interface{})
+
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--pkg", "-p":
+			if i+1 < len(args) {
+				params["pkg"] = args[i+1]
+				i++
+			}
+		case "--all":
+			params["all"] = true
+		case "--depth":
+			if i+1 < len(args) {
+				n, _ := strconv.Atoi(args[i+1])
+				params["depth"] = n
+				i++
+			}
+		case "--from":
+			if i+1 < len(args) {
+				t, _ := strconv.ParseInt(args[i+1], 10, 64)
+				params["from"] = t
+				i++
+			}
+		case "--to":
+			if i+1 < len(args) {
+				t, _ := strconv.ParseInt(args[i+1], 10, 64)
+				params["to"] = t
+				i++
+			}
+		}
+	}
+
+	switch subCmd {
+	case "paths":
+		if params["pkg"] == nil && params["all"] == nil {
+			fmt.Fprintf(os.Stderr, "缺少 --pkg 参数（汇总所有应用请使用 --all）\n")
+			os.Exit(2)
+		}
+		return sendCommand(socketPath, "report.paths", params)
+	default:
+		fmt.Fprintf(os.Stderr, "未知子命令: %s\n", subCmd)
+		os.Exit(2)
+	}
+	return nil, nil
+}
+
+func handleAlertCmd(socketPath string, args []string) (*Response, error) {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "用法: daemonctl alert <list|follow> [--rule <id>] [--pkg <package>] [--since <1h|ms>] [--n <n>]\n")
+		os.Exit(2)
+	}
+
+	subCmd := args[0]
+	params := make(map[string]interface{})
+
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--rule":
+			if i+1 < len(args) {
+				params["rule"] = args[i+1]
+				i++
+			}
+		case "--pkg", "-p":
+			if i+1 < len(args) {
+				params["pkg"] = args[i+1]
+				i++
+			}
+		case "--since":
+			if i+1 < len(args) {
+				// 时长（如 30m、1h）表示最近一段时间，纯数字为毫秒时间戳
+				if d, err := time.ParseDuration(args[i+1]); err == nil {
+					params["since"] = -d.Milliseconds()
+				} else if t, err := strconv.ParseInt(args[i+1], 10, 64); err == nil {
+					params["since"] = t
+				} else {
+					fmt.Fprintf(os.Stderr, "无效的 --since: %s\n", args[i+1])
+					os.Exit(2)
+				}
+				i++
+			}
+		case "--n":
+			if i+1 < len(args) {
+				n, _ := strconv.Atoi(args[i+1])
+				params["limit"] = n
+				i++
+			}
+		}
+	}
+
+	switch subCmd {
+	case "list":
+		return sendCommand(socketPath, "alert.list", params)
+	case "follow":
+		// --since/--n 只对 list 有意义
+		delete(params, "since")
+		delete(params, "limit")
+		followAlerts(socketPath, params)
+		return nil, nil
+	default:
+		fmt.Fprintf(os.Stderr, "未知子命令: %s\n", subCmd)
+		os.Exit(2)
+	}
+	return nil, nil
+}
+
+func handleDaemonCmd(socketPath string, args []string) (*Response, error) {
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, "用法: daemonctl daemon logs [--level <level>] [--component <name>] [--since <1h|ms>] [--contains <text>] [--n <n>]\n")
+		os.Exit(2)
+	}
+
+	subCmd := args[0]
+	params := make(map[string]interface{})
+
+	for i := 1; i < len(args); i++ {
+		switch args[i] {
+		case "--level":
+			if i+1 < len(args) {
+				params["level"] = args[i+1]
+				i++
+			}
+		case "--component", "-c":
+			if i+1 < len(args) {
+				params["component"] = args[i+1]
+				i++
+			}
+		case "--contains":
+			if i+1 < len(args) {
+				params["contains"] = args[i+1]
+				i++
+			}
+		case "--since":
+			if i+1 < len(args) {
+				// 时长（如 30m、1h）表示最近一段时间，纯数字为毫秒时间戳
+				if d, err := time.ParseDuration(args[i+1]); err == nil {
+					params["since"] = -d.Milliseconds()
+				} else if t, err := strconv.ParseInt(args[i+1], 10, 64); err == nil {
+					params["since"] = t
+				} else {
+					fmt.Fprintf(os.Stderr, "无效的 --since: %s\n", args[i+1])
+					os.Exit(2)
+				}
+				i++
+			}
+		case "--n":
+			if i+1 < len(args) {
+				n, _ := strconv.Atoi(args[i+1])
+				params["limit"] = n
+				i++
+			}
+		}
+	}
+
+	switch subCmd {
+	case "logs":
+		return sendCommand(socketPath, "daemon.logs", params)
+	default:
+		fmt.Fprintf(os.Stderr, "未知子命令: %s\n", subCmd)
+		os.Exit(2)
+	}
+	return nil, nil
+}
+
 func sendCommand(socketPath, cmd string, params map[string]interface{}) (*Response, error) {
 	// 构建请求
 	req := map[string]interface{}{
@@ -441,6 +881,177 @@ func sendCommand(socketPath, cmd string, params map[string]interface{}) (*Respon
 	return &resp, nil
 }
 
+// exportLogs 通过 log.export 流式接收导出内容，写入 --out 指定的文件或标准输出
+//
+// --out 以 .gz 结尾时自动启用 gzip；文件先写入 <out>.tmp，完整接收后再重命名。
+func exportLogs(socketPath string, params map[string]interface{}) {
+	out, _ := params["out"].(string)
+	delete(params, "out")
+	if strings.HasSuffix(out, ".gz") {
+		params["gzip"] = true
+	}
+
+	reqData, _ := json.Marshal(map[string]interface{}{
+		"cmd":    "log.export",
+		"params": params,
+	})
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		printError("E_DAEMON_UNREACHABLE", err.Error(), "", "")
+		os.Exit(10)
+	}
+	defer conn.Close()
+
+	writer := bufio.NewWriter(conn)
+	writer.Write(reqData)
+	writer.WriteByte('\n')
+	writer.Flush()
+
+	// 守护进程先完成导出再回复，数据量大时需要更长的等待
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Minute))
+	ackData, err := reader.ReadString('\n')
+	if err != nil {
+		printError("E_INTERNAL", err.Error(), "", "")
+		os.Exit(1)
+	}
+	var ack Response
+	if err := json.Unmarshal([]byte(ackData), &ack); err != nil {
+		printError("E_IPC_PROTOCOL", err.Error(), "", "")
+		os.Exit(1)
+	}
+	if ack.Error != nil {
+		printError(ack.Error.Code, ack.Error.Message, ack.Error.Field, ack.Error.Hint)
+		os.Exit(getExitCode(ack.Error.Code))
+	}
+
+	dst := os.Stdout
+	if out != "" {
+		dst, err = os.Create(out + ".tmp")
+		if err != nil {
+			printError("E_LOG_IO", err.Error(), "out", "")
+			os.Exit(1)
+		}
+	}
+	fail := func(code, msg string) {
+		if out != "" {
+			dst.Close()
+			os.Remove(out + ".tmp")
+		}
+		printError(code, msg, "", "")
+		os.Exit(1)
+	}
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			fail("E_IPC_PROTOCOL", "导出未完成，连接已断开: "+err.Error())
+		}
+
+		var ev struct {
+			Event   string `json:"event"`
+			Data    []byte `json:"data"`
+			Entries int    `json:"entries"`
+			Bytes   int64  `json:"bytes"`
+		}
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			fail("E_IPC_PROTOCOL", err.Error())
+		}
+
+		switch ev.Event {
+		case "chunk":
+			if _, err := dst.Write(ev.Data); err != nil {
+				fail("E_LOG_IO", err.Error())
+			}
+		case "end":
+			if out != "" {
+				if err := dst.Close(); err != nil {
+					fail("E_LOG_IO", err.Error())
+				}
+				if err := os.Rename(out+".tmp", out); err != nil {
+					fail("E_LOG_IO", err.Error())
+				}
+				fmt.Fprintf(os.Stderr, "已导出 %d 条日志到 %s（%d 字节）\n", ev.Entries, out, ev.Bytes)
+			}
+			os.Exit(0)
+		}
+	}
+}
+
+// followLogs 订阅 log.follow 并逐行输出新条目，连接断开后退出
+func followLogs(socketPath string, params map[string]interface{}) {
+	followEvents(socketPath, "log.follow", params, "log", "entry", "日志")
+}
+
+func followAlerts(socketPath string, params map[string]interface{}) {
+	followEvents(socketPath, "alert.follow", params, "alert", "alert", "告警")
+}
+
+// followEvents 订阅推送并逐行输出 event 事件中 field 字段的内容
+func followEvents(socketPath, cmd string, params map[string]interface{}, event, field, noun string) {
+	reqData, _ := json.Marshal(map[string]interface{}{
+		"cmd":    cmd,
+		"params": params,
+	})
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		printError("E_DAEMON_UNREACHABLE", err.Error(), "", "")
+		os.Exit(10)
+	}
+	defer conn.Close()
+
+	writer := bufio.NewWriter(conn)
+	writer.Write(reqData)
+	writer.WriteByte('\n')
+	writer.Flush()
+
+	reader := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	ackData, err := reader.ReadString('\n')
+	if err != nil {
+		printError("E_INTERNAL", err.Error(), "", "")
+		os.Exit(1)
+	}
+	var ack Response
+	if err := json.Unmarshal([]byte(ackData), &ack); err != nil {
+		printError("E_IPC_PROTOCOL", err.Error(), "", "")
+		os.Exit(1)
+	}
+	if ack.Error != nil {
+		printError(ack.Error.Code, ack.Error.Message, ack.Error.Field, ack.Error.Hint)
+		os.Exit(getExitCode(ack.Error.Code))
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	var dropped int64
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "连接已断开\n")
+			os.Exit(0)
+		}
+
+		var ev map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			continue
+		}
+		var name string
+		var evDropped int64
+		json.Unmarshal(ev["event"], &name)
+		json.Unmarshal(ev["dropped"], &evDropped)
+		if evDropped > dropped {
+			fmt.Fprintf(os.Stderr, "输出过慢，已丢弃 %d 条%s\n", evDropped-dropped, noun)
+			dropped = evDropped
+		}
+		if name == event {
+			fmt.Println(string(ev[field]))
+		}
+	}
+}
+
 func printUsage() {
 	fmt.Println("StorageRedirect Daemon Control")
 	fmt.Println()
@@ -452,8 +1063,29 @@ func printUsage() {
 	fmt.Println("  global <get|set>        全局配置管理")
 	fmt.Println("  monitor <get|set>       监控路径配置管理")
 	fmt.Println("  app <get|set|list|delete> [--pkg <pkg>] [--json '<json>']  应用配置管理")
+	fmt.Println("  app suspend --pkg <pkg> --duration <ms>  临时暂停应用规则")
+	fmt.Println("  app override --pkg <pkg> --json '<json>' --ttl <ms>  临时覆盖应用配置")
+	fmt.Println("  app <restore|overrides> [--pkg <pkg>]  恢复/列出临时覆盖")
 	fmt.Println("  log <tail|query|clear|stats> [--pkg <pkg>]  日志管理")
+	fmt.Println("  log query <--pkg <pkg>|--all> [--where '<expr>']  按表达式查询日志（--all 跨应用并按应用分组）")
+	fmt.Println("  log query ... [--limit <n>] [--cursor <nextCursor>]  按上一页返回的 nextCursor 翻页")
+	fmt.Println("  log follow [--pkg <pkg>] [--ops <op>] [--decision <d1,d2>] [--where '<expr>']  实时输出新日志")
+	fmt.Println("  log export [--format ndjson|csv] [--gzip] [--out <file>] [--pkg <pkg>] [--where '<expr>']  导出日志（默认输出到标准输出）")
+	fmt.Println("  log top [--by paths|denied] [--depth <n>] [--n <n>] [--pkg <pkg>] [--where '<expr>']  访问最多的路径 / 被拒绝最多的应用")
+	fmt.Println("  log sessions [--pkg <pkg>] [--from <ms>] [--to <ms>] [--path-prefix <p>] [--open] [--min-bytes <n>] [--limit <n>]  文件会话（open→read/write→close）")
+	fmt.Println("  log delete [--pkg <pkg>] [--from <ms>] [--to <ms>] [--path-prefix <p>] [--decision <d1,d2>] [--where '<expr>'] [--dry-run]  按条件删除日志条目（需要 root）")
+	fmt.Println("  log redact [--pattern <re>] [--replace <s>] [--fields path,mapped,uri,proc] [条件同 delete] [--dry-run]  对已有日志脱敏（不传 --pattern 时使用配置中的 redaction 规则；需要 root）")
+	fmt.Println("  log convert --encoding json|binary  转换已有日志分段的编码（新分段的编码由 logEncoding 决定）")
+	fmt.Println("  log verify              校验日志哈希链与签名检查点（需启用 logIntegrity）")
 	fmt.Println("  diag whoami [--pid <pid>]  诊断工具")
+	fmt.Println("  proc attribute [--pid <pid>] [--uid <uid>]  进程归属判断")
+	fmt.Println("  proc list               列出已连接的注入进程")
+	fmt.Println("  proc refresh [--pid <pid>|--pkg <pkg>]  通知进程重新加载规则")
+	fmt.Println("  runtime stale [--pkg <pkg>]  列出规则版本落后的进程")
+	fmt.Println("  alert list [--rule <id>] [--pkg <pkg>] [--since <1h|ms>] [--n <n>]  查看最近的告警")
+	fmt.Println("  alert follow [--rule <id>] [--pkg <pkg>]  实时输出新产生的告警")
+	fmt.Println("  report paths <--pkg <pkg>|--all> [--depth <n>] [--from <ms>] [--to <ms>]  应用的目录使用报告（读/写/创建/删除次数与最后访问时间）")
+	fmt.Println("  daemon logs [--level <level>] [--component <name>] [--since <1h|ms>] [--contains <text>] [--n <n>]  查看守护进程自身日志")
 	fmt.Println()
 	fmt.Println("示例:")
 	fmt.Println("  daemonctl ping")
@@ -461,6 +1093,12 @@ func printUsage() {
 	fmt.Println("  daemonctl app set --pkg com.example.app --json '{\"enabled\":true,\"redirectRules\":[]}'")
 	fmt.Println("  daemonctl monitor get")
 	fmt.Println("  daemonctl log tail --pkg com.example.app --n 20")
+	fmt.Println("  daemonctl log query --all --where 'path~\"/storage/emulated/0/DCIM/**\" and ts>=-1h'")
+	fmt.Println("  daemonctl log query --pkg com.example.app --where 'decision=DENY_RO and path~\"/DCIM/**\" and errno!=0'")
+	fmt.Println("  daemonctl log top --depth 5 --where 'ts>=-24h'")
+	fmt.Println("  daemonctl log export --format csv --out /sdcard/access.csv --pkg com.example.app")
+	fmt.Println("  daemonctl log top --by denied --n 5")
+	fmt.Println("  daemonctl daemon logs --level warn --since 1h")
 }
 
 func printError(code, message, field, hint string) {
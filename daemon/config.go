@@ -1,12 +1,14 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 // ConfigManager 管理分散的配置文件
@@ -15,14 +17,19 @@ type ConfigManager struct {
 	appsDir        string
 	globalPath     string
 	monitorPath    string
+	overridesPath  string
+	effectiveDir   string
 	
 	// 内存中的配置缓存
 	globalConfig   *GlobalConfig
 	monitorConfig  *MonitorConfig
 	appsCache      map[string]*AppConfig
+	overrides      map[string]*AppOverride
 	
 	mu             sync.RWMutex
+	effectiveMu    sync.Mutex // 串行化 effective 目录的写入
 	version        int
+	watchers       []func(version int)
 }
 
 // GlobalConfig 全局配置
@@ -30,6 +37,15 @@ type GlobalConfig struct {
 	MonitorEnabled bool                `json:"monitorEnabled"`
 	LogLevel       string              `json:"logLevel"`
 	MaxLogSizeMB   int                 `json:"maxLogSizeMB"`
+	LogEncoding    string              `json:"logEncoding"` // json | binary，只影响新写入的分段
+	LogRotation    LogRotationConfig   `json:"logRotation"`
+	LogRetention   LogRetention        `json:"logRetention"`
+	LogThrottle    LogThrottleConfig   `json:"logThrottle"`
+	LogFlush       LogFlushConfig      `json:"logFlush"`
+	LogIntegrity   LogIntegrityConfig  `json:"logIntegrity"`
+	DaemonLog      DaemonLogConfig     `json:"daemonLog"`
+	Alerts         []AlertRule         `json:"alerts"`
+	Redaction      []RedactRule        `json:"redaction"` // 写入时脱敏规则
 	Update         UpdateConfig        `json:"update"`
 	ProcessAttr    ProcessAttrConfig   `json:"processAttribution"`
 	URI            URIConfig           `json:"uri"`
@@ -64,6 +80,13 @@ type ProcessAttrConfig struct {
 	DiagnosticTagUnknown   bool   `json:"diagnosticTagUnknown"`
 }
 
+// LogRotationConfig 日志轮转配置
+type LogRotationConfig struct {
+	Mode              string `json:"mode"`              // daily：按天切换分段；size：仅按大小切换
+	SegmentSizeMB     int    `json:"segmentSizeMB"`     // 单个分段的最大大小
+	CompressAfterDays int    `json:"compressAfterDays"` // 超过 N 天的分段压缩为 .gz，0 表示不压缩
+}
+
 // URIConfig URI处理配置
 type URIConfig struct {
 	RedirectEnabled   bool   `json:"redirectEnabled"`
@@ -77,28 +100,35 @@ type AppConfig struct {
 	Enabled       bool           `json:"enabled"`
 	RedirectRules []RedirectRule `json:"redirectRules"`
 	ReadOnlyRules []ReadOnlyRule `json:"readOnlyRules"`
+	LogRetention  *LogRetention  `json:"logRetention,omitempty"`
+	Activation
 }
 
 // RedirectRule 重定向规则
 type RedirectRule struct {
 	Src string `json:"src"`
 	Dst string `json:"dst"`
+	Activation
 }
 
 // ReadOnlyRule 只读规则
 type ReadOnlyRule struct {
 	Path string `json:"path"`
+	Activation
 }
 
 // NewConfigManager 创建配置管理器
 func NewConfigManager(configDir string) (*ConfigManager, error) {
 	cm := &ConfigManager{
-		configDir:   configDir,
-		appsDir:     filepath.Join(configDir, "apps"),
-		globalPath:  filepath.Join(configDir, "global.json"),
-		monitorPath: filepath.Join(configDir, "monitor_paths.json"),
-		appsCache:   make(map[string]*AppConfig),
-		version:     1,
+		configDir:     configDir,
+		appsDir:       filepath.Join(configDir, "apps"),
+		globalPath:    filepath.Join(configDir, "global.json"),
+		monitorPath:   filepath.Join(configDir, "monitor_paths.json"),
+		overridesPath: filepath.Join(configDir, "overrides.json"),
+		effectiveDir:  filepath.Join(configDir, "effective"),
+		appsCache:     make(map[string]*AppConfig),
+		overrides:     make(map[string]*AppOverride),
+		version:       1,
 	}
 	
 	// 创建必要的目录
@@ -134,6 +164,11 @@ func (cm *ConfigManager) LoadAll() error {
 		return err
 	}
 	
+	// 加载临时覆盖配置
+	if err := cm.loadOverridesLocked(); err != nil {
+		return err
+	}
+	
 	return nil
 }
 
@@ -149,12 +184,13 @@ func (cm *ConfigManager) loadGlobalConfigLocked() error {
 		return err
 	}
 	
-	var config GlobalConfig
-	if err := json.Unmarshal(data, &config); err != nil {
+	// 在默认配置上解析，旧版配置缺少的字段保持默认值
+	config := DefaultGlobalConfig()
+	if err := json.Unmarshal(data, config); err != nil {
 		return fmt.Errorf("invalid global config: %w", err)
 	}
 	
-	cm.globalConfig = &config
+	cm.globalConfig = config
 	return nil
 }
 
@@ -275,7 +311,7 @@ func (cm *ConfigManager) SaveGlobalConfig(config *GlobalConfig) error {
 	}
 	
 	cm.globalConfig = config
-	cm.version++
+	cm.bumpVersionLocked()
 	return cm.saveGlobalConfigLocked()
 }
 
@@ -293,7 +329,7 @@ func (cm *ConfigManager) SaveMonitorConfig(config *MonitorConfig) error {
 	}
 	
 	cm.monitorConfig = config
-	cm.version++
+	cm.bumpVersionLocked()
 	return cm.saveMonitorConfigLocked()
 }
 
@@ -308,7 +344,7 @@ func (cm *ConfigManager) SaveAppConfig(pkg string, config *AppConfig) error {
 	}
 	
 	cm.appsCache[pkg] = config
-	cm.version++
+	cm.bumpVersionLocked()
 	return cm.saveAppLocked(pkg, config)
 }
 
@@ -365,7 +401,7 @@ func (cm *ConfigManager) DeleteAppConfig(pkg string) error {
 	defer cm.mu.Unlock()
 	
 	delete(cm.appsCache, pkg)
-	cm.version++
+	cm.bumpVersionLocked()
 	
 	path := filepath.Join(cm.appsDir, pkg+".json")
 	return os.Remove(path)
@@ -376,6 +412,7 @@ func (cm *ConfigManager) ListApps() []map[string]interface{} {
 	cm.mu.RLock()
 	defer cm.mu.RUnlock()
 	
+	now := time.Now()
 	var result []map[string]interface{}
 	for pkg, app := range cm.appsCache {
 		if !app.Enabled && len(app.RedirectRules) == 0 && len(app.ReadOnlyRules) == 0 {
@@ -385,6 +422,8 @@ func (cm *ConfigManager) ListApps() []map[string]interface{} {
 		result = append(result, map[string]interface{}{
 			"pkg":     pkg,
 			"enabled": app.Enabled,
+			"active":  app.Enabled && app.Activation.IsActive(now),
+			"override": cm.overrideKindLocked(pkg, now),
 			"counts": map[string]int{
 				"redirect": len(app.RedirectRules),
 				"readOnly": len(app.ReadOnlyRules),
@@ -401,12 +440,228 @@ func (cm *ConfigManager) GetVersion() int {
 	return cm.version
 }
 
+// BumpVersion 递增配置版本（配置内容未变但生效状态变化时使用）
+func (cm *ConfigManager) BumpVersion() int {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.bumpVersionLocked()
+	return cm.version
+}
+
+// Watch 注册配置变更回调，版本递增后异步调用
+func (cm *ConfigManager) Watch(fn func(version int)) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+	cm.watchers = append(cm.watchers, fn)
+}
+
+// bumpVersionLocked 递增版本并通知监听者（已加锁）
+func (cm *ConfigManager) bumpVersionLocked() {
+	cm.version++
+	for _, fn := range cm.watchers {
+		go fn(cm.version)
+	}
+}
+
+// GetEffectiveAppConfig 获取指定时间实际生效的应用配置
+//
+// 临时覆盖优先于已保存的配置；不在生效时间内的应用视为未启用，
+// 不在生效时间内的规则被移除。
+func (cm *ConfigManager) GetEffectiveAppConfig(pkg string, now time.Time) (*AppConfig, bool) {
+	if o, ok := cm.GetOverride(pkg); ok {
+		switch o.Kind {
+		case OverrideSuspend:
+			app, ok := cm.GetAppConfig(pkg)
+			if !ok {
+				app = &AppConfig{}
+			}
+			app.Enabled = false
+			return effectiveAppConfig(app, now), true
+		case OverrideReplace:
+			return effectiveAppConfig(o.App, now), true
+		}
+	}
+
+	app, ok := cm.GetAppConfig(pkg)
+	if !ok {
+		return nil, false
+	}
+	return effectiveAppConfig(app, now), true
+}
+
+// SyncEffectiveConfigs 将每个应用实际生效的配置写入 effective/<pkg>.json
+//
+// 钩子直接读取配置文件，生效时间与临时覆盖只有写入该目录后才会被新启动的
+// 进程加载；内容未变的文件不重写，已删除的应用对应的文件被移除。
+func (cm *ConfigManager) SyncEffectiveConfigs(now time.Time) error {
+	cm.effectiveMu.Lock()
+	defer cm.effectiveMu.Unlock()
+
+	cm.mu.RLock()
+	pkgs := make(map[string]bool, len(cm.appsCache)+len(cm.overrides))
+	for pkg := range cm.appsCache {
+		pkgs[pkg] = true
+	}
+	for pkg := range cm.overrides {
+		pkgs[pkg] = true
+	}
+	cm.mu.RUnlock()
+
+	if err := os.MkdirAll(cm.effectiveDir, 0755); err != nil {
+		return err
+	}
+
+	// 单个应用写入失败不影响其他应用，返回第一个错误
+	var firstErr error
+	for pkg := range pkgs {
+		if !isValidPackageName(pkg) {
+			delete(pkgs, pkg)
+			continue
+		}
+		app, ok := cm.GetEffectiveAppConfig(pkg, now)
+		if !ok {
+			delete(pkgs, pkg)
+			continue
+		}
+		if err := cm.writeEffectiveConfig(pkg, app); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %w", pkg, err)
+		}
+	}
+
+	entries, err := os.ReadDir(cm.effectiveDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		pkg, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !pkgs[pkg] {
+			os.Remove(filepath.Join(cm.effectiveDir, entry.Name()))
+		}
+	}
+	return firstErr
+}
+
+// writeEffectiveConfig 写入单个应用的生效配置，内容未变化时不写
+func (cm *ConfigManager) writeEffectiveConfig(pkg string, app *AppConfig) error {
+	data, err := json.MarshalIndent(app, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(cm.effectiveDir, pkg+".json")
+	if old, err := os.ReadFile(path); err == nil && bytes.Equal(old, data) {
+		return nil
+	}
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return err
+	}
+	return nil
+}
+
+// NextTransition 返回所有应用与规则中最近一次生效状态切换时间
+func (cm *ConfigManager) NextTransition(now time.Time) time.Time {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	var next time.Time
+	considerTime := func(t time.Time) {
+		if !t.IsZero() && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+	considerApp := func(app *AppConfig) {
+		considerTime(app.Activation.NextTransition(now))
+		for i := range app.RedirectRules {
+			considerTime(app.RedirectRules[i].NextTransition(now))
+		}
+		for i := range app.ReadOnlyRules {
+			considerTime(app.ReadOnlyRules[i].NextTransition(now))
+		}
+	}
+
+	for _, app := range cm.appsCache {
+		considerApp(app)
+	}
+
+	// 临时覆盖到期也是一次切换
+	for _, o := range cm.overrides {
+		considerTime(time.UnixMilli(o.ExpiresAt))
+		if o.App != nil {
+			considerApp(o.App)
+		}
+	}
+
+	return next
+}
+
+// overrideKindLocked 返回应用当前临时覆盖类型，没有则为空（已加锁）
+func (cm *ConfigManager) overrideKindLocked(pkg string, now time.Time) string {
+	o, ok := cm.overrides[pkg]
+	if !ok || o.expired(now) {
+		return ""
+	}
+	return o.Kind
+}
+
+// effectiveAppConfig 按生效时间过滤应用配置（会修改传入的配置）
+func effectiveAppConfig(app *AppConfig, now time.Time) *AppConfig {
+	if !app.Activation.IsActive(now) {
+		app.Enabled = false
+	}
+
+	redirects := make([]RedirectRule, 0, len(app.RedirectRules))
+	for _, rule := range app.RedirectRules {
+		if rule.IsActive(now) {
+			redirects = append(redirects, rule)
+		}
+	}
+	app.RedirectRules = redirects
+
+	readOnly := make([]ReadOnlyRule, 0, len(app.ReadOnlyRules))
+	for _, rule := range app.ReadOnlyRules {
+		if rule.IsActive(now) {
+			readOnly = append(readOnly, rule)
+		}
+	}
+	app.ReadOnlyRules = readOnly
+
+	return app
+}
+
 // DefaultGlobalConfig 返回默认全局配置
 func DefaultGlobalConfig() *GlobalConfig {
 	return &GlobalConfig{
 		MonitorEnabled: true,
 		LogLevel:       "info",
 		MaxLogSizeMB:   64,
+		LogEncoding:    encodingJSON,
+		LogRotation: LogRotationConfig{
+			Mode:              "daily",
+			SegmentSizeMB:     4,
+			CompressAfterDays: 3,
+		},
+		// 保留限制默认关闭，升级后不会删除已有日志
+		LogRetention: LogRetention{},
+		// 去重与限流默认关闭，需显式开启
+		LogThrottle: LogThrottleConfig{},
+		LogFlush: LogFlushConfig{
+			IntervalMs: 1000,
+			Fsync:      "interval",
+			Journal:    true,
+		},
+		LogIntegrity: LogIntegrityConfig{
+			CheckpointEvery: 1000,
+		},
+		DaemonLog: DaemonLogConfig{
+			Level:     "info",
+			MaxSizeKB: 1024,
+			Backups:   3,
+		},
+		Alerts: []AlertRule{},
+		Redaction: []RedactRule{},
 		Update: UpdateConfig{
 			PollIntervalMs:  3000,
 			OpCheckInterval: 50,
@@ -435,6 +690,14 @@ func validateAppConfig(app *AppConfig) error {
 		return fmt.Errorf("app config is nil")
 	}
 
+	if err := validateActivation(&app.Activation, "app"); err != nil {
+		return err
+	}
+
+	if err := validateLogRetention(app.LogRetention, "logRetention"); err != nil {
+		return err
+	}
+
 	// 验证重定向规则
 	for i, rule := range app.RedirectRules {
 		if !isAbsolutePath(rule.Src) {
@@ -443,6 +706,9 @@ func validateAppConfig(app *AppConfig) error {
 		if !isAbsolutePath(rule.Dst) {
 			return fmt.Errorf("redirectRules[%d].dst must be absolute path", i)
 		}
+		if err := validateActivation(&rule.Activation, fmt.Sprintf("redirectRules[%d]", i)); err != nil {
+			return err
+		}
 		// 规范化路径
 		app.RedirectRules[i].Src = normalizePath(rule.Src)
 		app.RedirectRules[i].Dst = normalizePath(rule.Dst)
@@ -453,6 +719,9 @@ func validateAppConfig(app *AppConfig) error {
 		if !isAbsolutePath(rule.Path) {
 			return fmt.Errorf("readOnlyRules[%d].path must be absolute path", i)
 		}
+		if err := validateActivation(&rule.Activation, fmt.Sprintf("readOnlyRules[%d]", i)); err != nil {
+			return err
+		}
 		app.ReadOnlyRules[i].Path = normalizePath(rule.Path)
 	}
 
@@ -460,10 +729,63 @@ func validateAppConfig(app *AppConfig) error {
 }
 
 func validateGlobalConfig(global *GlobalConfig) error {
+	if global == nil {
+		return fmt.Errorf("global config is required")
+	}
 	if global.MaxLogSizeMB < 8 || global.MaxLogSizeMB > 1024 {
 		return fmt.Errorf("maxLogSizeMB must be between 8 and 1024")
 	}
 
+	if global.LogLevel == "" {
+		global.LogLevel = "info"
+	}
+	if !logLevels[global.LogLevel] {
+		return fmt.Errorf("logLevel must be debug, info, warn, or error")
+	}
+
+	if global.LogEncoding == "" {
+		global.LogEncoding = encodingJSON
+	}
+	if !validLogEncoding(global.LogEncoding) {
+		return fmt.Errorf("logEncoding must be json or binary")
+	}
+
+	// 未提供轮转配置时使用默认值
+	if global.LogRotation == (LogRotationConfig{}) {
+		global.LogRotation = DefaultGlobalConfig().LogRotation
+	}
+	if global.LogRotation.Mode != "daily" && global.LogRotation.Mode != "size" {
+		return fmt.Errorf("logRotation.mode must be daily or size")
+	}
+	if global.LogRotation.SegmentSizeMB < 1 || global.LogRotation.SegmentSizeMB > global.MaxLogSizeMB/2 {
+		return fmt.Errorf("logRotation.segmentSizeMB must be between 1 and half of maxLogSizeMB")
+	}
+	if global.LogRotation.CompressAfterDays < 0 || global.LogRotation.CompressAfterDays > 365 {
+		return fmt.Errorf("logRotation.compressAfterDays must be between 0 and 365")
+	}
+
+	if err := validateLogRetention(&global.LogRetention, "logRetention"); err != nil {
+		return err
+	}
+	if err := validateLogThrottle(&global.LogThrottle); err != nil {
+		return err
+	}
+	if err := validateLogFlush(&global.LogFlush); err != nil {
+		return err
+	}
+	if err := validateLogIntegrity(&global.LogIntegrity); err != nil {
+		return err
+	}
+	if err := validateDaemonLog(&global.DaemonLog); err != nil {
+		return err
+	}
+	if err := validateAlertRules(global.Alerts); err != nil {
+		return err
+	}
+	if err := validateRedactRules(global.Redaction, "redaction"); err != nil {
+		return err
+	}
+
 	validModes := map[string]bool{"strict": true, "balanced": true, "relaxed": true}
 	if !validModes[global.ProcessAttr.Mode] {
 		return fmt.Errorf("processAttribution.mode must be strict, balanced, or relaxed")
@@ -477,6 +799,28 @@ func validateGlobalConfig(global *GlobalConfig) error {
 	return nil
 }
 
+// isValidPackageName 判断是否为合法的 Android 包名（以 . 分隔、字母开头的标识符），
+// 包名会用作配置文件名，不能包含路径分隔符或 ..
+func isValidPackageName(pkg string) bool {
+	if pkg == "" || len(pkg) > 255 {
+		return false
+	}
+	for _, part := range strings.Split(pkg, ".") {
+		if part == "" {
+			return false
+		}
+		for i, c := range part {
+			switch {
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+			case i > 0 && (c >= '0' && c <= '9' || c == '_'):
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func isAbsolutePath(path string) bool {
 	return strings.HasPrefix(path, "/")
 }
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LogCursor 查询游标，指向上一页最后一条日志的 (ts, seq)
+//
+// 查询结果按 (ts, seq) 降序排列，下一页只返回排在游标之后的条目，
+// 因此翻页期间写入的新日志不会导致重复或遗漏。没有 seq 的旧条目
+// （引入序号之前写入）以存储位置 Pos 区分，分段被重写后这类游标可能失效。
+type LogCursor struct {
+	Ts  int64
+	Seq int64
+	Pos int64
+}
+
+// cursorOf 返回指向条目的游标
+func cursorOf(e *LogEntry) *LogCursor {
+	c := &LogCursor{Ts: e.Ts, Seq: e.Seq}
+	if e.Seq == 0 {
+		c.Pos = e.pos
+	}
+	return c
+}
+
+// Encode 编码为不透明的游标字符串
+func (c *LogCursor) Encode() string {
+	raw := strconv.FormatInt(c.Ts, 10) + ":" + strconv.FormatInt(c.Seq, 10)
+	if c.Seq == 0 {
+		raw += ":" + strconv.FormatInt(c.Pos, 10)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// After 判断条目是否排在游标之后（更旧）
+func (c *LogCursor) After(e *LogEntry) bool {
+	if e.Ts != c.Ts {
+		return e.Ts < c.Ts
+	}
+	if e.Seq != c.Seq {
+		return e.Seq < c.Seq
+	}
+	return e.Seq == 0 && e.pos < c.Pos
+}
+
+// ParseLogCursor 解析游标字符串
+func ParseLogCursor(s string) (*LogCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf("malformed cursor")
+	}
+	c := &LogCursor{}
+	for i, p := range parts {
+		v, err := strconv.ParseInt(p, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed cursor")
+		}
+		switch i {
+		case 0:
+			c.Ts = v
+		case 1:
+			c.Seq = v
+		case 2:
+			c.Pos = v
+		}
+	}
+	return c, nil
+}
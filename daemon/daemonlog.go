@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// daemonLogName 守护进程自身日志，与访问日志位于同一目录
+const daemonLogName = "daemon.log"
+
+// logcatTag 转发到 logcat 时使用的标签
+const logcatTag = "StorageRedirect"
+
+// daemonLogLevels 守护进程日志级别
+var daemonLogLevels = map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
+// DaemonLogConfig 守护进程日志配置
+type DaemonLogConfig struct {
+	Level     string `json:"level"`     // debug | info | warn | error
+	MaxSizeKB int    `json:"maxSizeKB"` // daemon.log 超过该大小后轮转
+	Backups   int    `json:"backups"`   // 保留的 daemon.log.N 数量
+	Logcat    bool   `json:"logcat"`    // 同时转发到 Android logcat
+}
+
+func validateDaemonLog(c *DaemonLogConfig) error {
+	if _, ok := daemonLogLevels[c.Level]; !ok {
+		return fmt.Errorf("daemonLog.level must be debug, info, warn, or error")
+	}
+	if c.MaxSizeKB < 16 || c.MaxSizeKB > 64*1024 {
+		return fmt.Errorf("daemonLog.maxSizeKB must be between 16 and 65536")
+	}
+	if c.Backups < 0 || c.Backups > 20 {
+		return fmt.Errorf("daemonLog.backups must be between 0 and 20")
+	}
+	return nil
+}
+
+// DaemonLogRecord 一条守护进程日志
+type DaemonLogRecord struct {
+	Ts        int64  `json:"ts"`
+	Level     string `json:"level"`
+	Component string `json:"component"`
+	Msg       string `json:"msg"`
+}
+
+// DaemonLog 守护进程自身日志：按级别过滤，写入可轮转的 daemon.log（每行一条 JSON），
+// 同时输出到 stderr，可选转发到 logcat
+type DaemonLog struct {
+	path string
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	level    int
+	maxBytes int64
+	backups  int
+	logcat   *logcatWriter
+}
+
+// openDaemonLog 打开（追加写入）日志目录下的 daemon.log
+func openDaemonLog(dir string) (*DaemonLog, error) {
+	d := &DaemonLog{
+		path:     filepath.Join(dir, daemonLogName),
+		level:    daemonLogLevels["info"],
+		maxBytes: 1024 * 1024,
+		backups:  3,
+	}
+	if err := d.openLocked(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *DaemonLog) openLocked() error {
+	f, err := os.OpenFile(d.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	d.file = f
+	d.size = info.Size()
+	return nil
+}
+
+// Configure 应用配置
+func (d *DaemonLog) Configure(cfg DaemonLogConfig) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if level, ok := daemonLogLevels[cfg.Level]; ok {
+		d.level = level
+	}
+	if cfg.MaxSizeKB > 0 {
+		d.maxBytes = int64(cfg.MaxSizeKB) * 1024
+	}
+	d.backups = cfg.Backups
+
+	switch {
+	case cfg.Logcat && d.logcat == nil:
+		d.logcat = newLogcatWriter()
+	case !cfg.Logcat && d.logcat != nil:
+		d.logcat.Close()
+		d.logcat = nil
+	}
+}
+
+// Log 记录一条日志，低于当前级别的丢弃
+func (d *DaemonLog) Log(level, component, format string, v ...interface{}) {
+	rec := DaemonLogRecord{
+		Ts:        time.Now().UnixMilli(),
+		Level:     level,
+		Component: component,
+		Msg:       fmt.Sprintf(format, v...),
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if daemonLogLevels[level] < d.level {
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "[%s] %s %s: %s\n",
+		time.UnixMilli(rec.Ts).Format("2006-01-02 15:04:05"), strings.ToUpper(level), component, rec.Msg)
+
+	if d.logcat != nil {
+		d.logcat.Send(rec)
+	}
+
+	if d.file == nil {
+		return
+	}
+	data, _ := json.Marshal(rec)
+	data = append(data, '\n')
+	if d.size+int64(len(data)) > d.maxBytes {
+		d.rotateLocked()
+	}
+	if d.file == nil {
+		return
+	}
+	n, _ := d.file.Write(data)
+	d.size += int64(n)
+}
+
+// rotateLocked daemon.log -> daemon.log.1 -> ... -> daemon.log.N
+func (d *DaemonLog) rotateLocked() {
+	d.file.Close()
+	d.file = nil
+
+	if d.backups == 0 {
+		os.Remove(d.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", d.path, d.backups))
+		for i := d.backups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", d.path, i), fmt.Sprintf("%s.%d", d.path, i+1))
+		}
+		os.Rename(d.path, d.path+".1")
+	}
+	// 超出的旧备份（backups 调小后）
+	for i := d.backups + 1; ; i++ {
+		if os.Remove(fmt.Sprintf("%s.%d", d.path, i)) != nil {
+			break
+		}
+	}
+
+	if err := d.openLocked(); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to reopen %s: %v\n", d.path, err)
+	}
+}
+
+// DaemonLogFilter daemon.logs 查询条件
+type DaemonLogFilter struct {
+	Level     string // 最低级别
+	Component string
+	Since     int64
+	Contains  string
+}
+
+func (f *DaemonLogFilter) match(rec *DaemonLogRecord) bool {
+	if f.Level != "" && daemonLogLevels[rec.Level] < daemonLogLevels[f.Level] {
+		return false
+	}
+	if f.Component != "" && rec.Component != f.Component {
+		return false
+	}
+	if f.Since > 0 && rec.Ts < f.Since {
+		return false
+	}
+	if f.Contains != "" && !strings.Contains(rec.Msg, f.Contains) {
+		return false
+	}
+	return true
+}
+
+// Read 返回最近 limit 条匹配的日志，按时间升序
+func (d *DaemonLog) Read(filter DaemonLogFilter, limit int) ([]DaemonLogRecord, error) {
+	d.mu.Lock()
+	backups := d.backups
+	d.mu.Unlock()
+
+	// 从最新的文件向前读，够数即停
+	var result []DaemonLogRecord
+	for i := 0; i <= backups && len(result) < limit; i++ {
+		path := d.path
+		if i > 0 {
+			path = fmt.Sprintf("%s.%d", d.path, i)
+		}
+		records, err := readDaemonLogFile(path, &filter)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		result = append(records, result...)
+	}
+
+	if len(result) > limit {
+		result = result[len(result)-limit:]
+	}
+	if result == nil {
+		result = []DaemonLogRecord{}
+	}
+	return result, nil
+}
+
+func readDaemonLogFile(path string, filter *DaemonLogFilter) ([]DaemonLogRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []DaemonLogRecord
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var rec DaemonLogRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			continue
+		}
+		if filter.match(&rec) {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
+
+// Status 返回日志文件与转发状态（对应 status.daemon.log）
+func (d *DaemonLog) Status() map[string]interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	level := "info"
+	for name, v := range daemonLogLevels {
+		if v == d.level {
+			level = name
+		}
+	}
+	logcat := "off"
+	if d.logcat != nil {
+		logcat = d.logcat.method
+	}
+	return map[string]interface{}{
+		"path":      d.path,
+		"level":     level,
+		"sizeBytes": d.size,
+		"maxBytes":  d.maxBytes,
+		"backups":   d.backups,
+		"logcat":    logcat,
+	}
+}
+
+// Close 关闭日志文件与 logcat 转发
+func (d *DaemonLog) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.logcat != nil {
+		d.logcat.Close()
+		d.logcat = nil
+	}
+	if d.file != nil {
+		d.file.Close()
+		d.file = nil
+	}
+}
+
+// logcatWriter 异步转发日志到 logcat
+//
+// 优先写入旧内核的 /dev/log/main，不存在时调用 log 命令；两者都不可用时
+// method 为 unavailable。队列满时丢弃，不阻塞写日志的调用方。
+type logcatWriter struct {
+	method string // devlog | logcmd | unavailable
+	dev    *os.File
+	logCmd string
+	ch     chan DaemonLogRecord
+	done   chan struct{}
+}
+
+func newLogcatWriter() *logcatWriter {
+	w := &logcatWriter{
+		method: "unavailable",
+		ch:     make(chan DaemonLogRecord, 256),
+		done:   make(chan struct{}),
+	}
+	if f, err := os.OpenFile("/dev/log/main", os.O_WRONLY, 0); err == nil {
+		w.method = "devlog"
+		w.dev = f
+	} else if path, err := exec.LookPath("log"); err == nil {
+		w.method = "logcmd"
+		w.logCmd = path
+	}
+
+	go w.loop()
+	return w
+}
+
+// Send 放入转发队列
+func (w *logcatWriter) Send(rec DaemonLogRecord) {
+	if w.method == "unavailable" {
+		return
+	}
+	select {
+	case w.ch <- rec:
+	default:
+	}
+}
+
+// Close 停止转发
+func (w *logcatWriter) Close() {
+	close(w.ch)
+	<-w.done
+	if w.dev != nil {
+		w.dev.Close()
+	}
+}
+
+func (w *logcatWriter) loop() {
+	defer close(w.done)
+
+	for rec := range w.ch {
+		msg := rec.Component + ": " + rec.Msg
+		switch w.method {
+		case "devlog":
+			// 优先级 + 标签 + 消息，均以 \0 结尾
+			buf := make([]byte, 0, len(logcatTag)+len(msg)+3)
+			buf = append(buf, logcatPriority(rec.Level))
+			buf = append(buf, logcatTag...)
+			buf = append(buf, 0)
+			buf = append(buf, msg...)
+			buf = append(buf, 0)
+			w.dev.Write(buf)
+		case "logcmd":
+			exec.Command(w.logCmd, "-p", rec.Level[:1], "-t", logcatTag, msg).Run()
+		}
+	}
+}
+
+// logcatPriority 对应 android_LogPriority
+func logcatPriority(level string) byte {
+	switch level {
+	case "debug":
+		return 3
+	case "warn":
+		return 5
+	case "error":
+		return 6
+	}
+	return 4
+}
+
+// reportStartupFailure 守护进程创建失败时（Logger 尚未可用）将错误追加到 daemon.log
+func reportStartupFailure(err error) {
+	dir := logDirFromEnv()
+	os.MkdirAll(dir, 0755)
+	d, openErr := openDaemonLog(dir)
+	if openErr != nil {
+		return
+	}
+	defer d.Close()
+	d.Log("error", "daemon", "Failed to create daemon: %v", err)
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 导出格式
+const (
+	exportNDJSON = "ndjson"
+	exportCSV    = "csv"
+)
+
+// exportChunkSize 流式导出时每个分块的原始字节数
+const exportChunkSize = 48 * 1024
+
+// exportTempPattern 流式导出使用的临时文件
+const exportTempPattern = "export-*.tmp"
+
+// exportDirName 守护进程侧导出文件所在目录（位于日志目录下）
+const exportDirName = "exports"
+
+// csvColumns CSV 固定列，rule.* 与 extra.* 列按实际出现的键追加在后面
+var csvColumns = []string{
+	"ts", "time", "seq", "pkg", "proc", "pid", "tid", "uid", "op", "path", "uri", "mapped",
+	"decision", "result", "errno", "map.status", "map.method", "map.detail",
+	"count", "firstTs", "lastTs", "fd", "openId", "ino", "dev", "bytes",
+}
+
+// ExportOptions 导出选项
+type ExportOptions struct {
+	Format string // ndjson（默认）或 csv
+	Gzip   bool
+}
+
+// Validate 校验导出格式
+func (opts *ExportOptions) Validate() error {
+	switch opts.Format {
+	case "":
+		opts.Format = exportNDJSON
+	case exportNDJSON, exportCSV:
+	default:
+		return fmt.Errorf("unsupported export format %q", opts.Format)
+	}
+	return nil
+}
+
+// ExportResult 导出结果
+type ExportResult struct {
+	Format  string `json:"format"`
+	Gzip    bool   `json:"gzip"`
+	Entries int    `json:"entries"`
+	Bytes   int64  `json:"bytes"`
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Export 按写入顺序将匹配的条目导出到 w
+func (l *Logger) Export(w io.Writer, filter LogFilter, opts ExportOptions) (ExportResult, error) {
+	result := ExportResult{Format: opts.Format, Gzip: opts.Gzip}
+	if err := opts.Validate(); err != nil {
+		return result, err
+	}
+	result.Format = opts.Format
+
+	l.Flush()
+
+	counter := &countingWriter{w: w}
+	var out io.Writer = counter
+	var gz *gzip.Writer
+	if opts.Gzip {
+		gz = gzip.NewWriter(counter)
+		out = gz
+	}
+	buf := bufio.NewWriterSize(out, 64*1024)
+
+	var err error
+	if opts.Format == exportCSV {
+		result.Entries, err = l.exportCSV(buf, &filter)
+	} else {
+		result.Entries, err = l.exportNDJSON(buf, &filter)
+	}
+	if err != nil {
+		return result, err
+	}
+	if err := buf.Flush(); err != nil {
+		return result, err
+	}
+	if gz != nil {
+		if err := gz.Close(); err != nil {
+			return result, err
+		}
+	}
+	result.Bytes = counter.n
+	return result, nil
+}
+
+func (l *Logger) exportNDJSON(w io.Writer, filter *LogFilter) (int, error) {
+	n := 0
+	var writeErr error
+	err := l.store.Scan(filter, func(e *LogEntry) bool {
+		data, _ := json.Marshal(e)
+		data = append(data, '\n')
+		if _, writeErr = w.Write(data); writeErr != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if err != nil {
+		return n, err
+	}
+	return n, writeErr
+}
+
+// exportCSV 导出 CSV，rule、map、extra 展开为 rule.<key>、map.<key>、extra.<key> 列
+//
+// rule.* 与 extra.* 的列需要先扫描一遍才能确定，因此会读取两遍匹配的条目。
+func (l *Logger) exportCSV(w io.Writer, filter *LogFilter) (int, error) {
+	ruleKeys := make(map[string]bool)
+	extraKeys := make(map[string]bool)
+	err := l.store.Scan(filter, func(e *LogEntry) bool {
+		flattenInto(ruleKeys, nil, "", e.Rule)
+		flattenInto(extraKeys, nil, "", e.Extra)
+		return true
+	})
+	if err != nil {
+		return 0, err
+	}
+	rules := sortedKeys(ruleKeys)
+	extras := sortedKeys(extraKeys)
+
+	cw := csv.NewWriter(w)
+	header := append([]string{}, csvColumns...)
+	for _, k := range rules {
+		header = append(header, "rule."+k)
+	}
+	for _, k := range extras {
+		header = append(header, "extra."+k)
+	}
+	if err := cw.Write(header); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	var writeErr error
+	ruleValues := make(map[string]string)
+	extraValues := make(map[string]string)
+	err = l.store.Scan(filter, func(e *LogEntry) bool {
+		row := make([]string, 0, len(header))
+		row = append(row,
+			strconv.FormatInt(e.Ts, 10),
+			time.UnixMilli(e.Ts).Format("2006-01-02 15:04:05.000"),
+			strconv.FormatInt(e.Seq, 10),
+			e.Pkg, e.Proc,
+			strconv.Itoa(e.Pid), strconv.Itoa(e.Tid), strconv.Itoa(e.Uid),
+			e.Op, e.Path, e.URI, e.Mapped, e.Decision, e.Result,
+		)
+		if e.Errno != nil {
+			row = append(row, strconv.Itoa(*e.Errno))
+		} else {
+			row = append(row, "")
+		}
+		if e.Map != nil {
+			row = append(row, e.Map.Status, e.Map.Method, e.Map.Detail)
+		} else {
+			row = append(row, "", "", "")
+		}
+		row = append(row, strconv.Itoa(e.events()), optionalTs(e.FirstTs), optionalTs(e.LastTs))
+		fd := ""
+		if e.Fd != nil {
+			fd = strconv.Itoa(*e.Fd)
+		}
+		row = append(row, fd, optionalInt(e.OpenID),
+			optionalUint(e.Ino), optionalUint(e.Dev), optionalInt(e.Bytes))
+
+		clear(ruleValues)
+		clear(extraValues)
+		flattenInto(nil, ruleValues, "", e.Rule)
+		flattenInto(nil, extraValues, "", e.Extra)
+		for _, k := range rules {
+			row = append(row, ruleValues[k])
+		}
+		for _, k := range extras {
+			row = append(row, extraValues[k])
+		}
+
+		if writeErr = cw.Write(row); writeErr != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if err != nil {
+		return n, err
+	}
+	if writeErr != nil {
+		return n, writeErr
+	}
+	cw.Flush()
+	return n, cw.Error()
+}
+
+// flattenInto 将嵌套对象展开为 a.b.c 形式的键，keys 收集键名，values 收集取值
+func flattenInto(keys map[string]bool, values map[string]string, prefix string, m map[string]interface{}) {
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if child, ok := v.(map[string]interface{}); ok {
+			flattenInto(keys, values, key, child)
+			continue
+		}
+		if keys != nil {
+			keys[key] = true
+		}
+		if values != nil {
+			values[key] = csvValue(v)
+		}
+	}
+}
+
+func optionalTs(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return strconv.FormatInt(ts, 10)
+}
+
+func optionalInt(v int64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+func optionalUint(v uint64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func csvValue(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case bool:
+		return strconv.FormatBool(x)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	default:
+		data, _ := json.Marshal(x)
+		return string(data)
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ExportFile 导出到日志目录下 exports 目录中名为 name 的文件，返回文件路径
+//
+// 守护进程以 root 运行，因此只接受不含路径的文件名，且不覆盖已存在的文件
+// （包括符号链接）。先写临时文件再以硬链接放到目标位置，失败时不会留下不完整的文件。
+func (l *Logger) ExportFile(name string, filter LogFilter, opts ExportOptions) (string, ExportResult, error) {
+	if name == "" || name == "." || name == ".." || name != filepath.Base(name) || strings.HasSuffix(name, ".tmp") {
+		return "", ExportResult{}, fmt.Errorf("export name must be a plain file name: %s", name)
+	}
+
+	dir := filepath.Join(l.baseDir, exportDirName)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", ExportResult{}, err
+	}
+	if fi, err := os.Lstat(dir); err != nil {
+		return "", ExportResult{}, err
+	} else if !fi.IsDir() {
+		return "", ExportResult{}, fmt.Errorf("export directory is not a directory: %s", dir)
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Lstat(path); err == nil {
+		return "", ExportResult{}, fmt.Errorf("export file already exists: %s", path)
+	}
+
+	f, err := os.CreateTemp(dir, exportTempPattern)
+	if err != nil {
+		return "", ExportResult{}, err
+	}
+	tmp := f.Name()
+
+	result, err := l.Export(f, filter, opts)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// Link 在目标已存在时失败，不会替换期间新建的文件或符号链接
+		err = os.Link(tmp, path)
+	}
+	os.Remove(tmp)
+	if err != nil {
+		return "", result, err
+	}
+	return path, result, nil
+}
+
+// ExportTemp 导出到日志目录下的临时文件，用于流式传输；调用方负责关闭并删除
+//
+// 先落盘再传输，避免客户端读取缓慢时长时间持有存储的读锁。
+func (l *Logger) ExportTemp(filter LogFilter, opts ExportOptions) (*os.File, ExportResult, error) {
+	f, err := os.CreateTemp(l.baseDir, exportTempPattern)
+	if err != nil {
+		return nil, ExportResult{}, err
+	}
+
+	result, err := l.Export(f, filter, opts)
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, result, err
+	}
+	return f, result, nil
+}
+
+// removeStaleExports 删除上次异常退出时遗留的导出临时文件
+func removeStaleExports(dir string) {
+	matches, _ := filepath.Glob(filepath.Join(dir, exportTempPattern))
+	more, _ := filepath.Glob(filepath.Join(dir, exportDirName, exportTempPattern))
+	for _, m := range append(matches, more...) {
+		os.Remove(m)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LogFlushConfig 访问日志缓冲区刷新配置
+type LogFlushConfig struct {
+	IntervalMs int    `json:"intervalMs"` // 后台刷新周期
+	Fsync      string `json:"fsync"`      // always | interval | never
+	Journal    bool   `json:"journal"`    // 缓冲区写入预写文件，崩溃后启动时恢复
+}
+
+func validateLogFlush(f *LogFlushConfig) error {
+	if f.IntervalMs < 100 || f.IntervalMs > 60000 {
+		return fmt.Errorf("logFlush.intervalMs must be between 100 and 60000")
+	}
+	if f.Fsync != fsyncAlways && f.Fsync != fsyncInterval && f.Fsync != fsyncNever {
+		return fmt.Errorf("logFlush.fsync must be always, interval, or never")
+	}
+	return nil
+}
+
+// LogFlusher 按配置的周期在后台刷新访问日志缓冲区
+//
+// Logger.Write 只在缓冲区满或距上次刷新超过 5 秒的写入时刷新，
+// 没有新写入时缓冲区中的条目会一直留在内存里，由这里定期写入存储。
+type LogFlusher struct {
+	configManager *ConfigManager
+	logger        *Logger
+
+	mu        sync.Mutex
+	interval  time.Duration
+	lastRunAt int64
+	lastError string
+
+	wakeCh chan struct{}
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewLogFlusher 创建后台刷新器
+func NewLogFlusher(cm *ConfigManager, logger *Logger) *LogFlusher {
+	f := &LogFlusher{
+		configManager: cm,
+		logger:        logger,
+		wakeCh:        make(chan struct{}, 1),
+		stopCh:        make(chan struct{}),
+	}
+
+	f.apply()
+
+	// 配置变更后按新的周期与 fsync 策略刷新
+	cm.Watch(func(int) { f.Wake() })
+
+	return f
+}
+
+// Start 启动刷新循环
+func (f *LogFlusher) Start() {
+	f.wg.Add(1)
+	go f.loop()
+}
+
+// Stop 停止刷新循环并做最后一次刷新
+func (f *LogFlusher) Stop() {
+	close(f.stopCh)
+	f.wg.Wait()
+}
+
+// Wake 通知刷新器重新读取配置
+func (f *LogFlusher) Wake() {
+	select {
+	case f.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (f *LogFlusher) loop() {
+	defer f.wg.Done()
+
+	ticker := time.NewTicker(f.currentInterval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-f.stopCh:
+			f.run(time.Now())
+			return
+		case <-f.wakeCh:
+			f.apply()
+			ticker.Reset(f.currentInterval())
+		case <-ticker.C:
+			f.run(time.Now())
+		}
+	}
+}
+
+// apply 将全局配置同步到 Logger
+func (f *LogFlusher) apply() {
+	cfg := f.configManager.GetGlobalConfig().LogFlush
+	f.logger.SetFlushPolicy(cfg.Fsync, cfg.Journal)
+
+	interval := time.Duration(cfg.IntervalMs) * time.Millisecond
+	if interval <= 0 {
+		interval = time.Second
+	}
+	f.mu.Lock()
+	f.interval = interval
+	f.mu.Unlock()
+}
+
+func (f *LogFlusher) currentInterval() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.interval
+}
+
+// run 执行一次刷新
+func (f *LogFlusher) run(now time.Time) {
+	var errMsg string
+	if err := f.logger.Flush(); err != nil {
+		errMsg = err.Error()
+		f.logger.Errorf("flusher", "Failed to flush access log: %v", err)
+	}
+
+	f.mu.Lock()
+	f.lastRunAt = now.UnixMilli()
+	f.lastError = errMsg
+	f.mu.Unlock()
+}
+
+// Status 返回刷新状态（对应 status.logs.flush）
+func (f *LogFlusher) Status() map[string]interface{} {
+	cfg := f.configManager.GetGlobalConfig().LogFlush
+	journal := f.logger.journalStatus()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status := map[string]interface{}{
+		"intervalMs": f.interval.Milliseconds(),
+		"fsync":      cfg.Fsync,
+		"journal":    cfg.Journal,
+		"recovered":  journal.recovered,
+		"buffered":   journal.buffered,
+		"lastRunAt":  f.lastRunAt,
+	}
+	if f.lastError != "" {
+		status["lastError"] = f.lastError
+	} else if journal.lastError != "" {
+		status["lastError"] = journal.lastError
+	}
+	return status
+}
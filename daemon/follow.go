@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sync/atomic"
+)
+
+// 订阅队列长度
+const (
+	defaultFollowQueue = 256
+	maxFollowQueue     = 4096
+)
+
+// LogSubscription 日志订阅，Logger.Write 写入的匹配条目会推入队列
+//
+// 队列满时丢弃新条目并累加 Dropped，写入方不会因慢速订阅者阻塞。
+type LogSubscription struct {
+	ID      int64
+	filter  LogFilter
+	ch      chan LogEntry
+	dropped atomic.Int64
+}
+
+// C 返回条目队列
+func (sub *LogSubscription) C() <-chan LogEntry {
+	return sub.ch
+}
+
+// Dropped 返回因队列已满而丢弃的条目数
+func (sub *LogSubscription) Dropped() int64 {
+	return sub.dropped.Load()
+}
+
+// Subscribe 订阅新写入的日志条目
+func (l *Logger) Subscribe(filter LogFilter, queueSize int) *LogSubscription {
+	if queueSize <= 0 {
+		queueSize = defaultFollowQueue
+	}
+	if queueSize > maxFollowQueue {
+		queueSize = maxFollowQueue
+	}
+
+	l.subMu.Lock()
+	defer l.subMu.Unlock()
+
+	l.nextSubID++
+	sub := &LogSubscription{
+		ID:     l.nextSubID,
+		filter: filter,
+		ch:     make(chan LogEntry, queueSize),
+	}
+	l.subs[sub.ID] = sub
+	return sub
+}
+
+// Unsubscribe 取消订阅
+func (l *Logger) Unsubscribe(sub *LogSubscription) {
+	l.subMu.Lock()
+	defer l.subMu.Unlock()
+	delete(l.subs, sub.ID)
+}
+
+// SubscriberCount 返回当前订阅者数量
+func (l *Logger) SubscriberCount() int {
+	l.subMu.RLock()
+	defer l.subMu.RUnlock()
+	return len(l.subs)
+}
+
+// publish 将条目推送给匹配的订阅者（不阻塞）
+func (l *Logger) publish(entry *LogEntry) {
+	l.subMu.RLock()
+	defer l.subMu.RUnlock()
+
+	for _, sub := range l.subs {
+		if !sub.filter.Match(entry) {
+			continue
+		}
+		select {
+		case sub.ch <- *entry:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
@@ -0,0 +1,586 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 完整性模式使用的文件，与访问日志位于同一目录
+const (
+	integrityKeyName  = "integrity.key"
+	checkpointsName   = "checkpoints.jsonl"
+	maxVerifyFindings = 20
+)
+
+// 检查点类型
+const (
+	checkpointChain   = "chain"   // 链上某条目的哈希
+	checkpointEnable  = "enable"  // 之后写入的条目带哈希
+	checkpointDisable = "disable" // 之后写入的条目不带哈希
+	checkpointPrune   = "prune"   // 守护进程删除了条目（清空、按条件删除、保留限制、大小限制）
+	checkpointRedact  = "redact"  // 守护进程脱敏了 ranges 中带哈希的条目
+)
+
+// LogIntegrityConfig 访问日志完整性配置
+type LogIntegrityConfig struct {
+	Enabled         bool `json:"enabled"`
+	CheckpointEvery int  `json:"checkpointEvery"` // 每写入多少条目生成一个签名检查点
+}
+
+func validateLogIntegrity(c *LogIntegrityConfig) error {
+	if c.CheckpointEvery == 0 {
+		c.CheckpointEvery = DefaultGlobalConfig().LogIntegrity.CheckpointEvery
+	}
+	if c.CheckpointEvery < 10 || c.CheckpointEvery > 100000 {
+		return fmt.Errorf("logIntegrity.checkpointEvery must be between 10 and 100000")
+	}
+	return nil
+}
+
+// logCheckpoint 签名检查点
+//
+// 每个检查点的 prev 为上一个检查点的签名，删除或调换检查点同样会被发现。
+type logCheckpoint struct {
+	Kind    string     `json:"kind"`
+	Seq     int64      `json:"seq"`
+	Ts      int64      `json:"ts"`
+	Hash    string     `json:"hash,omitempty"`
+	Removed int        `json:"removed,omitempty"`
+	Ranges  [][2]int64 `json:"ranges,omitempty"` // redact：被修改条目的序号区间
+	Reason  string     `json:"reason,omitempty"`
+	Prev    string     `json:"prev,omitempty"`
+	Sig     string     `json:"sig"`
+}
+
+func (cp *logCheckpoint) payload() []byte {
+	c := *cp
+	c.Sig = ""
+	data, _ := json.Marshal(&c)
+	return data
+}
+
+// entryHash 计算条目哈希：除 hash 字段外的规范 JSON（含 prev）的 SHA-256
+func entryHash(e *LogEntry) string {
+	c := *e
+	c.Hash = ""
+	data, _ := json.Marshal(&c)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// logIntegrity 哈希链状态
+//
+// 条目在刷新写入存储前按序号顺序链接：prev 为上一条已写入条目的哈希
+// （上一条不带哈希时为空），hash 覆盖条目内容与 prev。每隔 checkpointEvery
+// 条以及守护进程退出时，用设备本地的 ed25519 密钥对链尾哈希签名并追加
+// 到 checkpoints.jsonl。开关完整性模式与守护进程自身删除条目时同样记录
+// 签名检查点，log.verify 据此区分正常删除与篡改。
+//
+// 密钥保存在日志目录中，只能发现不持有密钥的修改；需要更强的保证时，
+// 应将 status 中的 publicKey 与最近的检查点另行保存。
+type logIntegrity struct {
+	dir string
+
+	mu          sync.Mutex
+	enabled     bool // 已生效的状态（下次刷新时应用 desired）
+	desired     bool
+	every       int
+	key         ed25519.PrivateKey
+	lastHash    string // 最后写入条目的哈希
+	lastSeq     int64  // 最后写入条目的序号
+	lastCpSeq   int64  // 最近一个 chain 检查点的序号
+	lastSig     string // 最近一个检查点的签名
+	maxCpSeq    int64
+	checkpoints int
+	lastError   string
+}
+
+// openLogIntegrity 读取密钥、检查点与链尾状态
+func openLogIntegrity(dir string, store *logStore) (*logIntegrity, error) {
+	g := &logIntegrity{
+		dir:   dir,
+		every: DefaultGlobalConfig().LogIntegrity.CheckpointEvery,
+	}
+
+	if seed, err := os.ReadFile(filepath.Join(dir, integrityKeyName)); err == nil && len(seed) == ed25519.SeedSize {
+		g.key = ed25519.NewKeyFromSeed(seed)
+	}
+
+	cps, err := readCheckpoints(filepath.Join(dir, checkpointsName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, cp := range cps {
+		switch cp.Kind {
+		case checkpointEnable:
+			g.enabled = true
+		case checkpointDisable:
+			g.enabled = false
+		case checkpointChain:
+			g.lastCpSeq = cp.Seq
+		}
+		if cp.Seq > g.maxCpSeq {
+			g.maxCpSeq = cp.Seq
+		}
+		g.lastSig = cp.Sig
+	}
+	g.desired = g.enabled
+	g.checkpoints = len(cps)
+
+	if err := g.resync(store); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// resync 从存储中最后一条条目恢复链尾
+func (g *logIntegrity) resync(store *logStore) error {
+	last, err := store.Last()
+	if err != nil {
+		return err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.lastHash, g.lastSeq = "", 0
+	if last != nil {
+		g.lastHash, g.lastSeq = last.Hash, last.Seq
+	}
+	return nil
+}
+
+func readCheckpoints(path string) ([]logCheckpoint, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var cps []logCheckpoint
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var cp logCheckpoint
+		if err := json.Unmarshal(scanner.Bytes(), &cp); err != nil {
+			// 损坏的行保留为空检查点，由 log.verify 报告
+			cps = append(cps, logCheckpoint{})
+			continue
+		}
+		cps = append(cps, cp)
+	}
+	return cps, scanner.Err()
+}
+
+// loadOrCreateKeyLocked 返回签名密钥，首次使用时生成
+func (g *logIntegrity) loadOrCreateKeyLocked() (ed25519.PrivateKey, error) {
+	if g.key != nil {
+		return g.key, nil
+	}
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(g.dir, integrityKeyName)
+	if err := os.WriteFile(path+".tmp", seed, 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		os.Remove(path + ".tmp")
+		return nil, err
+	}
+	g.key = ed25519.NewKeyFromSeed(seed)
+	return g.key, nil
+}
+
+// checkpointLocked 签名并追加一个检查点
+func (g *logIntegrity) checkpointLocked(cp logCheckpoint) error {
+	key, err := g.loadOrCreateKeyLocked()
+	if err != nil {
+		return err
+	}
+	cp.Ts = time.Now().UnixMilli()
+	cp.Prev = g.lastSig
+	cp.Sig = base64.StdEncoding.EncodeToString(ed25519.Sign(key, cp.payload()))
+
+	f, err := os.OpenFile(filepath.Join(g.dir, checkpointsName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	data, _ := json.Marshal(&cp)
+	data = append(data, '\n')
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	g.lastSig = cp.Sig
+	g.checkpoints++
+	if cp.Kind == checkpointChain {
+		g.lastCpSeq = cp.Seq
+	}
+	if cp.Seq > g.maxCpSeq {
+		g.maxCpSeq = cp.Seq
+	}
+	return nil
+}
+
+func (g *logIntegrity) recordError(err error) {
+	if err != nil {
+		g.lastError = err.Error()
+	}
+}
+
+// configure 设置完整性模式，开关在下次刷新时生效
+func (g *logIntegrity) configure(cfg LogIntegrityConfig) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.desired = cfg.Enabled
+	if cfg.CheckpointEvery > 0 {
+		g.every = cfg.CheckpointEvery
+	}
+}
+
+// link 为即将写入存储的条目（按序号升序）计算哈希，必要时先记录开关检查点
+func (g *logIntegrity) link(entries []LogEntry) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.desired != g.enabled {
+		kind := checkpointDisable
+		if g.desired {
+			kind = checkpointEnable
+		}
+		// 开关检查点的序号为最后写入条目的序号，之后的条目按新状态写入
+		err := g.checkpointLocked(logCheckpoint{Kind: kind, Seq: g.lastSeq, Hash: g.lastHash})
+		g.recordError(err)
+		if err == nil {
+			g.enabled = g.desired
+		}
+	}
+
+	for i := range entries {
+		e := &entries[i]
+		e.Prev, e.Hash = "", ""
+		if g.enabled {
+			e.Prev = g.lastHash
+			e.Hash = entryHash(e)
+		}
+		g.lastHash = e.Hash
+		g.lastSeq = e.Seq
+	}
+}
+
+// committed 条目写入存储后调用，距上个检查点足够多条目时生成检查点
+func (g *logIntegrity) committed(force bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.enabled || g.lastHash == "" || g.lastSeq <= g.lastCpSeq {
+		return
+	}
+	if !force && g.lastSeq-g.lastCpSeq < int64(g.every) {
+		return
+	}
+	g.recordError(g.checkpointLocked(logCheckpoint{Kind: checkpointChain, Seq: g.lastSeq, Hash: g.lastHash}))
+}
+
+// prune 记录守护进程删除的条目；完整性模式从未启用时不记录
+func (g *logIntegrity) prune(seq int64, removed int, reason string) {
+	if removed <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.enabled && g.checkpoints == 0 {
+		return
+	}
+	g.recordError(g.checkpointLocked(logCheckpoint{Kind: checkpointPrune, Seq: seq, Removed: removed, Reason: reason}))
+}
+
+// redacted 记录脱敏修改过的带哈希条目（seqs 升序）
+//
+// 脱敏后的条目保留原哈希，链接关系不变，但内容已无法按哈希校验；
+// log.verify 对检查点中记录的序号只报告数量，不视为篡改。
+func (g *logIntegrity) redacted(seq int64, seqs []int64, reason string) {
+	if len(seqs) == 0 {
+		return
+	}
+	var ranges [][2]int64
+	for _, s := range seqs {
+		if n := len(ranges); n > 0 && ranges[n-1][1]+1 >= s {
+			ranges[n-1][1] = max(ranges[n-1][1], s)
+			continue
+		}
+		ranges = append(ranges, [2]int64{s, s})
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.recordError(g.checkpointLocked(logCheckpoint{Kind: checkpointRedact, Seq: seq, Ranges: ranges, Reason: reason}))
+}
+
+// publicKey 返回签名公钥（base64），尚未生成密钥时为空
+func (g *logIntegrity) publicKey() string {
+	if g.key == nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(g.key.Public().(ed25519.PublicKey))
+}
+
+// status 返回完整性模式状态（对应 status.logs.integrity）
+func (g *logIntegrity) status() map[string]interface{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	status := map[string]interface{}{
+		"enabled":           g.enabled,
+		"checkpointEvery":   g.every,
+		"checkpoints":       g.checkpoints,
+		"lastSeq":           g.lastSeq,
+		"lastCheckpointSeq": g.lastCpSeq,
+		"publicKey":         g.publicKey(),
+	}
+	if g.lastError != "" {
+		status["lastError"] = g.lastError
+	}
+	return status
+}
+
+// VerifyFinding 校验发现的问题
+type VerifyFinding struct {
+	Seq    int64  `json:"seq"`
+	Ts     int64  `json:"ts,omitempty"`
+	Pkg    string `json:"pkg,omitempty"`
+	Kind   string `json:"kind"` // checkpoint | hash | link | missing | order | truncated
+	Reason string `json:"reason"`
+}
+
+// VerifyResult log.verify 结果
+type VerifyResult struct {
+	Valid       bool            `json:"valid"`
+	Entries     int             `json:"entries"`
+	Hashed      int             `json:"hashed"`
+	Unhashed    int             `json:"unhashed"`
+	FirstSeq    int64           `json:"firstSeq"`
+	LastSeq     int64           `json:"lastSeq"`
+	Missing     int64           `json:"missing"`  // 序号缺口中的条目数
+	Pruned      int64           `json:"pruned"`   // 检查点记录的守护进程删除的条目数
+	Redacted    int             `json:"redacted"` // 经脱敏、内容不再与哈希一致的条目数
+	Checkpoints int             `json:"checkpoints"`
+	PublicKey   string          `json:"publicKey"`
+	FirstBroken *VerifyFinding  `json:"firstBroken"`
+	Findings    []VerifyFinding `json:"findings"`
+}
+
+func (r *VerifyResult) report(f VerifyFinding) {
+	if r.FirstBroken == nil {
+		r.FirstBroken = &f
+	}
+	if len(r.Findings) < maxVerifyFindings {
+		r.Findings = append(r.Findings, f)
+	}
+	r.Valid = false
+}
+
+// Verify 校验检查点签名与整个哈希链，返回第一处断链
+func (l *Logger) Verify() (*VerifyResult, error) {
+	if err := l.Flush(); err != nil {
+		return nil, err
+	}
+
+	g := l.integ
+	g.mu.Lock()
+	var pub ed25519.PublicKey
+	if g.key != nil {
+		pub = g.key.Public().(ed25519.PublicKey)
+	}
+	result := &VerifyResult{Valid: true, PublicKey: g.publicKey(), Findings: []VerifyFinding{}}
+	g.mu.Unlock()
+
+	cps, err := readCheckpoints(filepath.Join(l.baseDir, checkpointsName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	result.Checkpoints = len(cps)
+
+	// 检查点签名与顺序
+	var toggles, prunes []logCheckpoint
+	var redactions [][2]int64
+	chainAt := make(map[int64]string)
+	prevSig := ""
+	for i, cp := range cps {
+		sig, decodeErr := base64.StdEncoding.DecodeString(cp.Sig)
+		switch {
+		case cp.Kind == "":
+			result.report(VerifyFinding{Kind: "checkpoint", Reason: fmt.Sprintf("checkpoint %d is unreadable", i+1)})
+		case pub == nil:
+			result.report(VerifyFinding{Seq: cp.Seq, Kind: "checkpoint", Reason: "signing key is missing"})
+		case decodeErr != nil || !ed25519.Verify(pub, cp.payload(), sig):
+			result.report(VerifyFinding{Seq: cp.Seq, Kind: "checkpoint", Reason: fmt.Sprintf("checkpoint %d has an invalid signature", i+1)})
+		case cp.Prev != prevSig:
+			result.report(VerifyFinding{Seq: cp.Seq, Kind: "checkpoint", Reason: fmt.Sprintf("checkpoint %d does not follow the previous checkpoint", i+1)})
+		}
+		prevSig = cp.Sig
+
+		switch cp.Kind {
+		case checkpointEnable, checkpointDisable:
+			toggles = append(toggles, cp)
+		case checkpointPrune:
+			prunes = append(prunes, cp)
+			result.Pruned += int64(cp.Removed)
+		case checkpointRedact:
+			redactions = append(redactions, cp.Ranges...)
+		case checkpointChain:
+			chainAt[cp.Seq] = cp.Hash
+		}
+	}
+
+	// redactedAt 序号为 seq 的条目是否被守护进程脱敏过
+	redactedAt := func(seq int64) bool {
+		for _, r := range redactions {
+			if seq >= r[0] && seq <= r[1] {
+				return true
+			}
+		}
+		return false
+	}
+
+	// prunedAfter 序号不大于 seq 的条目写入后守护进程是否删除过条目
+	prunedAfter := func(seq int64) bool {
+		for _, p := range prunes {
+			if p.Seq >= seq {
+				return true
+			}
+		}
+		return false
+	}
+	// hashedAt 写入序号为 seq 的条目时是否处于完整性模式
+	hashedAt := func(seq int64) bool {
+		on := false
+		for _, t := range toggles {
+			if t.Seq < seq {
+				on = t.Kind == checkpointEnable
+			}
+		}
+		return on
+	}
+	// protected 序号 from..to 之间是否有条目在完整性模式下写入
+	protected := func(from, to int64) bool {
+		if hashedAt(from) {
+			return true
+		}
+		for _, t := range toggles {
+			if t.Kind == checkpointEnable && t.Seq >= from && t.Seq < to {
+				return true
+			}
+		}
+		return false
+	}
+
+	var prevSeq int64
+	prevHash := ""
+	var firstGap *VerifyFinding
+	err = l.store.Scan(&LogFilter{}, func(e *LogEntry) bool {
+		result.Entries++
+		if e.Seq == 0 {
+			// 早期版本写入的条目没有序号
+			result.Unhashed++
+			prevHash = ""
+			return true
+		}
+		if result.FirstSeq == 0 {
+			result.FirstSeq = e.Seq
+		}
+		result.LastSeq = e.Seq
+
+		finding := func(kind, reason string) VerifyFinding {
+			return VerifyFinding{Seq: e.Seq, Ts: e.Ts, Pkg: e.Pkg, Kind: kind, Reason: reason}
+		}
+
+		gap := e.Seq - prevSeq - 1
+		if gap < 0 {
+			result.report(finding("order", fmt.Sprintf("sequence %d follows %d", e.Seq, prevSeq)))
+		} else if gap > 0 && protected(prevSeq+1, e.Seq-1) {
+			result.Missing += gap
+			f := finding("missing", fmt.Sprintf("entries %d..%d are missing", prevSeq+1, e.Seq-1))
+			if !prunedAfter(e.Seq - 1) {
+				f.Reason += " and no removal was recorded"
+				result.report(f)
+			} else if firstGap == nil {
+				firstGap = &f
+			}
+		}
+
+		if e.Hash == "" {
+			if hashedAt(e.Seq) {
+				result.report(finding("hash", "entry has no hash although integrity mode was enabled"))
+			}
+			result.Unhashed++
+		} else {
+			result.Hashed++
+			hashOK := entryHash(e) == e.Hash
+			if !hashOK && redactedAt(e.Seq) {
+				result.Redacted++
+				hashOK = true
+			}
+			if !hashOK {
+				result.report(finding("hash", "entry content does not match its hash"))
+			} else if e.Prev != prevHash && gap <= 0 {
+				result.report(finding("link", "entry does not link to the previous entry"))
+			}
+		}
+		if want, ok := chainAt[e.Seq]; ok {
+			if want != e.Hash {
+				result.report(finding("checkpoint", "entry hash differs from the signed checkpoint"))
+			}
+			delete(chainAt, e.Seq)
+		}
+
+		prevSeq = e.Seq
+		prevHash = e.Hash
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查点引用的条目已不存在且之后没有删除记录：尾部被截断或条目被删除
+	missing := make([]int64, 0, len(chainAt))
+	for seq := range chainAt {
+		missing = append(missing, seq)
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+	for _, seq := range missing {
+		if prunedAfter(seq) {
+			continue
+		}
+		if seq > result.LastSeq {
+			result.report(VerifyFinding{Seq: seq, Kind: "truncated",
+				Reason: fmt.Sprintf("signed checkpoint at %d is beyond the last entry %d", seq, result.LastSeq)})
+		} else {
+			result.report(VerifyFinding{Seq: seq, Kind: "missing",
+				Reason: fmt.Sprintf("entry %d referenced by a signed checkpoint is missing", seq)})
+		}
+	}
+
+	if result.Valid && result.Missing > result.Pruned && firstGap != nil {
+		firstGap.Reason += fmt.Sprintf(" (%d entries missing, %d removals recorded)", result.Missing, result.Pruned)
+		result.report(*firstGap)
+	}
+	return result, nil
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// 日志预写文件：journal.<代>.jsonl
+const (
+	journalPrefix = "journal."
+	journalExt    = ".jsonl"
+)
+
+// fsync 策略
+const (
+	fsyncAlways   = "always"   // 每条日志写入预写文件后立即落盘，每次刷新后存储落盘
+	fsyncInterval = "interval" // 每次刷新后存储落盘，预写文件只保证进程崩溃不丢失
+	fsyncNever    = "never"    // 不主动落盘
+)
+
+// logJournal 缓冲区的预写文件
+//
+// 进入缓冲区的条目先追加到当前代的预写文件；每次刷新时切换到新的一代，
+// 旧文件在条目写入存储后删除。启动时重放遗留的预写文件，序号不大于
+// 存储中最大序号的条目视为已写入而跳过。
+type logJournal struct {
+	dir     string
+	enabled bool
+	fsync   string
+	gen     int64
+	file    *os.File
+}
+
+func journalPath(dir string, gen int64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%06d%s", journalPrefix, gen, journalExt))
+}
+
+// parseJournalName 解析预写文件名中的代号
+func parseJournalName(name string) (int64, bool) {
+	if !strings.HasPrefix(name, journalPrefix) || !strings.HasSuffix(name, journalExt) {
+		return 0, false
+	}
+	gen, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, journalPrefix), journalExt), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return gen, true
+}
+
+// openLogJournal 重放遗留的预写文件并返回新的预写文件，同时返回恢复的条目数
+//
+// 恢复的条目与正常刷新一样按完整性模式链接后写入存储。
+func openLogJournal(dir string, store *logStore, integ *logIntegrity) (*logJournal, int, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var gens []int64
+	for _, de := range dirEntries {
+		if gen, ok := parseJournalName(de.Name()); ok {
+			gens = append(gens, gen)
+		}
+	}
+	sort.Slice(gens, func(i, j int) bool { return gens[i] < gens[j] })
+
+	j := &logJournal{dir: dir, enabled: true, fsync: fsyncInterval, gen: 1}
+	if len(gens) == 0 {
+		return j, 0, nil
+	}
+	j.gen = gens[len(gens)-1] + 1
+
+	lastSeq := store.LastSeq()
+	var recovered []LogEntry
+	for _, gen := range gens {
+		entries, err := readJournal(journalPath(dir, gen))
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, e := range entries {
+			if e.Seq > lastSeq {
+				recovered = append(recovered, e)
+			}
+		}
+	}
+
+	integ.link(recovered)
+	if err := store.Append(recovered); err != nil {
+		return nil, 0, err
+	}
+	if err := store.Sync(); err != nil {
+		return nil, 0, err
+	}
+	integ.committed(false)
+	for _, gen := range gens {
+		os.Remove(journalPath(dir, gen))
+	}
+	return j, len(recovered), nil
+}
+
+// readJournal 读取预写文件，跳过崩溃时写了一半的行
+func readJournal(path string) ([]LogEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []LogEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var e LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// append 追加一条日志
+func (j *logJournal) append(e *LogEntry) error {
+	if !j.enabled {
+		return nil
+	}
+	if j.file == nil {
+		f, err := os.OpenFile(journalPath(j.dir, j.gen), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		j.file = f
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := j.file.Write(data); err != nil {
+		return err
+	}
+	if j.fsync == fsyncAlways {
+		return j.file.Sync()
+	}
+	return nil
+}
+
+// rotate 切换到新的一代，返回旧预写文件路径（没有写入过时返回空）
+func (j *logJournal) rotate() string {
+	if j.file == nil {
+		return ""
+	}
+	old := j.file.Name()
+	j.file.Close()
+	j.file = nil
+	j.gen++
+	return old
+}
+
+// close 关闭预写文件；缓冲区已全部写入存储时一并删除
+func (j *logJournal) close(remove bool) {
+	if j.file == nil {
+		return
+	}
+	path := j.file.Name()
+	j.file.Close()
+	j.file = nil
+	if remove {
+		os.Remove(path)
+	}
+}
+
+// SetFlushPolicy 设置 fsync 策略与是否启用预写文件
+func (l *Logger) SetFlushPolicy(fsync string, journal bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if fsync != fsyncAlways && fsync != fsyncNever {
+		fsync = fsyncInterval
+	}
+	l.journal.fsync = fsync
+	l.journal.enabled = journal
+}
+
+// journalState 预写文件状态
+type journalState struct {
+	recovered int
+	buffered  int
+	lastError string
+}
+
+// journalStatus 返回启动时恢复的条目数、当前缓冲的条目数与最近一次预写错误
+func (l *Logger) journalStatus() journalState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return journalState{
+		recovered: l.recovered,
+		buffered:  len(l.buffer),
+		lastError: l.journalErr,
+	}
+}
@@ -0,0 +1,559 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+)
+
+// 日志编码
+const (
+	encodingJSON   = "json"
+	encodingBinary = "binary"
+)
+
+// 二进制数据块：魔数 + 负载长度 + 负载 CRC32，负载为字符串表与长度前缀的记录
+//
+//	"SRB1" | uint32 len | uint32 crc | uvarint nStrings {uvarint len, bytes}...
+//	| uvarint nEntries {uvarint recLen, record}...
+//
+// 字符串表在块内去重，pkg、proc、op、decision 等取值以及路径的目录部分
+// 只保存一次；每个块独立解码，查询时仍可按块跳过。
+var binaryBlockMagic = [4]byte{'S', 'R', 'B', '1'}
+
+const binaryBlockHeader = 12
+
+// 记录字段标签，值为 0 或空的字段不写入
+const (
+	tagTs       = 1  // zigzag，相对上一条目
+	tagSeq      = 2  // zigzag，相对上一条目
+	tagPkg      = 3  // 字符串下标
+	tagProc     = 4  // 字符串下标
+	tagPid      = 5  // zigzag
+	tagTid      = 6  // zigzag
+	tagUid      = 7  // zigzag
+	tagOp       = 8  // 字符串下标
+	tagPath     = 9  // 目录下标 + 文件名下标
+	tagURI      = 10 // 字符串下标
+	tagMapped   = 11 // 目录下标 + 文件名下标
+	tagDecision = 12 // 字符串下标
+	tagRule     = 13 // JSON 字符串下标
+	tagResult   = 14 // 字符串下标
+	tagErrno    = 15 // zigzag
+	tagMap      = 16 // status、method、detail 三个字符串下标
+	tagExtra    = 17 // JSON 字符串下标
+	tagCount    = 18 // uvarint
+	tagFirstTs  = 19 // zigzag，相对 ts
+	tagLastTs   = 20 // zigzag，相对 ts
+	tagPrevLink = 21 // prev 等于上一条目的 hash，无值
+	tagPrev     = 22 // 32 字节
+	tagHash     = 23 // 32 字节
+	tagPrevStr  = 24 // 字符串下标（非标准哈希）
+	tagHashStr  = 25 // 字符串下标（非标准哈希）
+	tagFd       = 26 // zigzag
+	tagOpenID   = 27 // zigzag
+	tagIno      = 28 // uvarint
+	tagDev      = 29 // uvarint
+	tagBytes    = 30 // zigzag
+)
+
+var errBinaryBlock = errors.New("corrupt binary block")
+
+// validLogEncoding 判断编码名称是否有效
+func validLogEncoding(enc string) bool {
+	return enc == encodingJSON || enc == encodingBinary
+}
+
+// encodeBlock 按分段编码将条目编码为一个数据块，返回数据与块索引
+func encodeBlock(entries []LogEntry, bin bool, off int64) ([]byte, *blockIndex) {
+	if bin {
+		return encodeBinaryBlock(entries, off)
+	}
+
+	var buf bytes.Buffer
+	b := newBlockIndex(off)
+	for i := range entries {
+		data, err := json.Marshal(&entries[i])
+		if err != nil {
+			continue
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+		b.add(&entries[i], int64(len(data)+1))
+	}
+	b.Len = int64(buf.Len())
+	return buf.Bytes(), b
+}
+
+// decodeBlock 解码一个数据块，跳过损坏的条目
+func decodeBlock(data []byte, bin bool, n int) []LogEntry {
+	if bin {
+		entries, _ := decodeBinaryBlock(data)
+		return entries
+	}
+
+	entries := make([]LogEntry, 0, n)
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		var entry LogEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			continue // 跳过损坏的行
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// stringTable 块内字符串表
+type stringTable struct {
+	index map[string]uint64
+	list  []string
+}
+
+func (t *stringTable) ref(s string) uint64 {
+	if i, ok := t.index[s]; ok {
+		return i
+	}
+	i := uint64(len(t.list))
+	t.index[s] = i
+	t.list = append(t.list, s)
+	return i
+}
+
+// splitPath 拆分为目录（含末尾 /）与文件名
+func splitPath(p string) (string, string) {
+	i := strings.LastIndexByte(p, '/')
+	return p[:i+1], p[i+1:]
+}
+
+// hashBytes 将 64 位小写十六进制哈希转为 32 字节，格式不符时返回 nil
+func hashBytes(h string) []byte {
+	if len(h) != 64 || strings.ToLower(h) != h {
+		return nil
+	}
+	b, err := hex.DecodeString(h)
+	if err != nil {
+		return nil
+	}
+	return b
+}
+
+func encodeBinaryBlock(entries []LogEntry, off int64) ([]byte, *blockIndex) {
+	table := &stringTable{index: make(map[string]uint64)}
+	var records bytes.Buffer
+	var rec []byte
+	recSizes := make([]int, 0, len(entries))
+
+	var prevTs, prevSeq int64
+	prevHash := ""
+	for i := range entries {
+		e := &entries[i]
+		rec = rec[:0]
+
+		str := func(tag byte, s string) {
+			if s != "" {
+				rec = append(rec, tag)
+				rec = binary.AppendUvarint(rec, table.ref(s))
+			}
+		}
+		num := func(tag byte, v int64) {
+			if v != 0 {
+				rec = append(rec, tag)
+				rec = binary.AppendVarint(rec, v)
+			}
+		}
+		path := func(tag byte, p string) {
+			if p != "" {
+				dir, base := splitPath(p)
+				rec = append(rec, tag)
+				rec = binary.AppendUvarint(rec, table.ref(dir))
+				rec = binary.AppendUvarint(rec, table.ref(base))
+			}
+		}
+		object := func(tag byte, m map[string]interface{}) {
+			if len(m) > 0 {
+				data, _ := json.Marshal(m)
+				str(tag, string(data))
+			}
+		}
+
+		num(tagTs, e.Ts-prevTs)
+		num(tagSeq, e.Seq-prevSeq)
+		str(tagPkg, e.Pkg)
+		str(tagProc, e.Proc)
+		num(tagPid, int64(e.Pid))
+		num(tagTid, int64(e.Tid))
+		num(tagUid, int64(e.Uid))
+		str(tagOp, e.Op)
+		path(tagPath, e.Path)
+		str(tagURI, e.URI)
+		path(tagMapped, e.Mapped)
+		str(tagDecision, e.Decision)
+		object(tagRule, e.Rule)
+		str(tagResult, e.Result)
+		if e.Errno != nil {
+			rec = append(rec, tagErrno)
+			rec = binary.AppendVarint(rec, int64(*e.Errno))
+		}
+		if e.Map != nil {
+			rec = append(rec, tagMap)
+			rec = binary.AppendUvarint(rec, table.ref(e.Map.Status))
+			rec = binary.AppendUvarint(rec, table.ref(e.Map.Method))
+			rec = binary.AppendUvarint(rec, table.ref(e.Map.Detail))
+		}
+		object(tagExtra, e.Extra)
+		if e.Fd != nil {
+			rec = append(rec, tagFd)
+			rec = binary.AppendVarint(rec, int64(*e.Fd))
+		}
+		num(tagOpenID, e.OpenID)
+		if e.Ino != 0 {
+			rec = append(rec, tagIno)
+			rec = binary.AppendUvarint(rec, e.Ino)
+		}
+		if e.Dev != 0 {
+			rec = append(rec, tagDev)
+			rec = binary.AppendUvarint(rec, e.Dev)
+		}
+		num(tagBytes, e.Bytes)
+		if e.Count != 0 {
+			rec = append(rec, tagCount)
+			rec = binary.AppendUvarint(rec, uint64(e.Count))
+		}
+		if e.FirstTs != 0 {
+			rec = append(rec, tagFirstTs)
+			rec = binary.AppendVarint(rec, e.FirstTs-e.Ts)
+		}
+		if e.LastTs != 0 {
+			rec = append(rec, tagLastTs)
+			rec = binary.AppendVarint(rec, e.LastTs-e.Ts)
+		}
+		switch {
+		case e.Prev == "":
+		case e.Prev == prevHash:
+			rec = append(rec, tagPrevLink)
+		case hashBytes(e.Prev) != nil:
+			rec = append(rec, tagPrev)
+			rec = append(rec, hashBytes(e.Prev)...)
+		default:
+			str(tagPrevStr, e.Prev)
+		}
+		if h := hashBytes(e.Hash); h != nil {
+			rec = append(rec, tagHash)
+			rec = append(rec, h...)
+		} else {
+			str(tagHashStr, e.Hash)
+		}
+
+		var lenBuf [binary.MaxVarintLen64]byte
+		n := binary.PutUvarint(lenBuf[:], uint64(len(rec)))
+		records.Write(lenBuf[:n])
+		records.Write(rec)
+		recSizes = append(recSizes, n+len(rec))
+
+		prevTs, prevSeq, prevHash = e.Ts, e.Seq, e.Hash
+	}
+
+	payload := binary.AppendUvarint(nil, uint64(len(table.list)))
+	for _, s := range table.list {
+		payload = binary.AppendUvarint(payload, uint64(len(s)))
+		payload = append(payload, s...)
+	}
+	tableBytes := len(payload)
+	payload = binary.AppendUvarint(payload, uint64(len(entries)))
+	payload = append(payload, records.Bytes()...)
+
+	data := make([]byte, binaryBlockHeader, binaryBlockHeader+len(payload))
+	copy(data, binaryBlockMagic[:])
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(data[8:], crc32.ChecksumIEEE(payload))
+	data = append(data, payload...)
+
+	// 字符串表与块头按条目数平摊到各条目的字节数中
+	b := newBlockIndex(off)
+	shared := int64(binaryBlockHeader + tableBytes)
+	for i := range entries {
+		size := int64(recSizes[i]) + shared/int64(len(entries))
+		b.add(&entries[i], size)
+	}
+	b.Len = int64(len(data))
+	return data, b
+}
+
+// binaryReader 从块负载中读取 varint 与字符串下标
+type binaryReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func (r *binaryReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.buf[r.pos:])
+	if n <= 0 {
+		r.err = errBinaryBlock
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *binaryReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.buf[r.pos:])
+	if n <= 0 {
+		r.err = errBinaryBlock
+		return 0
+	}
+	r.pos += n
+	return v
+}
+
+func (r *binaryReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || r.pos+n > len(r.buf) {
+		r.err = errBinaryBlock
+		return nil
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+// readBinaryHeader 解析块头，返回负载长度与 CRC
+func readBinaryHeader(h []byte) (int64, uint32, error) {
+	if len(h) < binaryBlockHeader || !bytes.Equal(h[:4], binaryBlockMagic[:]) {
+		return 0, 0, errBinaryBlock
+	}
+	return int64(binary.LittleEndian.Uint32(h[4:])), binary.LittleEndian.Uint32(h[8:]), nil
+}
+
+// decodeBinaryBlock 解码一个二进制数据块；块校验失败时返回错误，单条记录损坏时跳过该记录
+func decodeBinaryBlock(data []byte) ([]LogEntry, error) {
+	size, crc, err := readBinaryHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) < binaryBlockHeader+size {
+		return nil, errBinaryBlock
+	}
+	payload := data[binaryBlockHeader : binaryBlockHeader+size]
+	if crc32.ChecksumIEEE(payload) != crc {
+		return nil, errBinaryBlock
+	}
+
+	r := &binaryReader{buf: payload}
+	nStrings := r.uvarint()
+	if r.err != nil || nStrings > uint64(len(payload)) {
+		return nil, errBinaryBlock
+	}
+	table := make([]string, nStrings)
+	for i := range table {
+		table[i] = string(r.bytes(int(r.uvarint())))
+	}
+	count := r.uvarint()
+	if r.err != nil || count > uint64(len(payload)) {
+		return nil, errBinaryBlock
+	}
+
+	entries := make([]LogEntry, 0, count)
+	var prevTs, prevSeq int64
+	prevHash := ""
+	for i := uint64(0); i < count; i++ {
+		recLen := int(r.uvarint())
+		body := r.bytes(recLen)
+		if r.err != nil {
+			break
+		}
+		e, ok := decodeBinaryRecord(body, table, prevTs, prevSeq, prevHash)
+		if !ok {
+			continue
+		}
+		entries = append(entries, e)
+		prevTs, prevSeq, prevHash = e.Ts, e.Seq, e.Hash
+	}
+	return entries, r.err
+}
+
+func decodeBinaryRecord(body []byte, table []string, prevTs, prevSeq int64, prevHash string) (LogEntry, bool) {
+	r := &binaryReader{buf: body}
+	e := LogEntry{Ts: prevTs, Seq: prevSeq}
+
+	str := func() string {
+		i := r.uvarint()
+		if i >= uint64(len(table)) {
+			r.err = errBinaryBlock
+			return ""
+		}
+		return table[i]
+	}
+	object := func() map[string]interface{} {
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(str()), &m); err != nil && r.err == nil {
+			r.err = err
+		}
+		return m
+	}
+
+	var firstDelta, lastDelta int64
+	var hasFirst, hasLast bool
+	for r.err == nil && r.pos < len(body) {
+		tag := body[r.pos]
+		r.pos++
+		switch tag {
+		case tagTs:
+			e.Ts = prevTs + r.varint()
+		case tagSeq:
+			e.Seq = prevSeq + r.varint()
+		case tagPkg:
+			e.Pkg = str()
+		case tagProc:
+			e.Proc = str()
+		case tagPid:
+			e.Pid = int(r.varint())
+		case tagTid:
+			e.Tid = int(r.varint())
+		case tagUid:
+			e.Uid = int(r.varint())
+		case tagOp:
+			e.Op = str()
+		case tagPath:
+			e.Path = str() + str()
+		case tagURI:
+			e.URI = str()
+		case tagMapped:
+			e.Mapped = str() + str()
+		case tagDecision:
+			e.Decision = str()
+		case tagRule:
+			e.Rule = object()
+		case tagResult:
+			e.Result = str()
+		case tagErrno:
+			errno := int(r.varint())
+			e.Errno = &errno
+		case tagMap:
+			e.Map = &MapInfo{Status: str(), Method: str(), Detail: str()}
+		case tagExtra:
+			e.Extra = object()
+		case tagFd:
+			fd := int(r.varint())
+			e.Fd = &fd
+		case tagOpenID:
+			e.OpenID = r.varint()
+		case tagIno:
+			e.Ino = r.uvarint()
+		case tagDev:
+			e.Dev = r.uvarint()
+		case tagBytes:
+			e.Bytes = r.varint()
+		case tagCount:
+			e.Count = int(r.uvarint())
+		case tagFirstTs:
+			firstDelta, hasFirst = r.varint(), true
+		case tagLastTs:
+			lastDelta, hasLast = r.varint(), true
+		case tagPrevLink:
+			e.Prev = prevHash
+		case tagPrev:
+			e.Prev = hex.EncodeToString(r.bytes(32))
+		case tagHash:
+			e.Hash = hex.EncodeToString(r.bytes(32))
+		case tagPrevStr:
+			e.Prev = str()
+		case tagHashStr:
+			e.Hash = str()
+		default:
+			r.err = fmt.Errorf("unknown record tag %d", tag)
+		}
+	}
+	if hasFirst {
+		e.FirstTs = e.Ts + firstDelta
+	}
+	if hasLast {
+		e.LastTs = e.Ts + lastDelta
+	}
+	return e, r.err == nil
+}
+
+// indexBinaryRange 扫描二进制数据块并生成块索引
+func indexBinaryRange(r io.Reader, from int64) ([]*blockIndex, error) {
+	var blocks []*blockIndex
+	off := from
+	header := make([]byte, binaryBlockHeader)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			break
+		}
+		size, _, err := readBinaryHeader(header)
+		if err != nil {
+			break
+		}
+		data := make([]byte, binaryBlockHeader+size)
+		copy(data, header)
+		if _, err := io.ReadFull(r, data[binaryBlockHeader:]); err != nil {
+			break
+		}
+
+		entries, _ := decodeBinaryBlock(data)
+		b := newBlockIndex(off)
+		for i := range entries {
+			b.add(&entries[i], int64(len(data))/int64(len(entries)))
+		}
+		b.Len = int64(len(data))
+		blocks = append(blocks, b)
+		off += b.Len
+	}
+	return blocks, nil
+}
+
+// truncatePartialBlock 截掉二进制分段末尾不完整的数据块，返回截断后的大小
+func truncatePartialBlock(path string) (int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := st.Size()
+
+	var off int64
+	header := make([]byte, binaryBlockHeader)
+	for off < size {
+		if _, err := f.ReadAt(header, off); err != nil {
+			break
+		}
+		n, _, err := readBinaryHeader(header)
+		if err != nil || off+binaryBlockHeader+n > size {
+			break
+		}
+		off += binaryBlockHeader + n
+	}
+
+	if off != size {
+		return off, f.Truncate(off)
+	}
+	return size, nil
+}
@@ -1,12 +1,10 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
-	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -15,6 +13,7 @@ import (
 // LogEntry 日志条目
 type LogEntry struct {
 	Ts       int64                  `json:"ts"`
+	Seq      int64                  `json:"seq,omitempty"`
 	Pkg      string                 `json:"pkg"`
 	Proc     string                 `json:"proc"`
 	Pid      int                    `json:"pid"`
@@ -30,6 +29,43 @@ type LogEntry struct {
 	Errno    *int                   `json:"errno,omitempty"`
 	Map      *MapInfo               `json:"map,omitempty"`
 	Extra    map[string]interface{} `json:"extra,omitempty"`
+
+	// 文件会话关联：同一次打开产生的 open/read/write/close 带相同的 fd 与 openId
+	// 目前没有任何来源填写这些字段：原生钩子尚未上报 fd/openId/ino/dev/bytes，
+	// 守护进程内也还没有调用 Logger.Write 的写入方，因此 log.sessions 暂时总是为空
+	Fd     *int   `json:"fd,omitempty"`     // 指针以区分 fd 0 与未填写
+	OpenID int64  `json:"openId,omitempty"` // 钩子为每次成功打开分配的标识，fd 被复用时可区分
+	Ino    uint64 `json:"ino,omitempty"`
+	Dev    uint64 `json:"dev,omitempty"`
+	Bytes  int64  `json:"bytes,omitempty"` // read/write 实际传输的字节数
+
+	// 去重合并或限流汇总的条目：事件数与首末时间
+	Count   int   `json:"count,omitempty"`
+	FirstTs int64 `json:"firstTs,omitempty"`
+	LastTs  int64 `json:"lastTs,omitempty"`
+
+	// 完整性模式：上一条目的哈希与本条目的哈希
+	Prev string `json:"prev,omitempty"`
+	Hash string `json:"hash,omitempty"`
+
+	// 读取时填入的存储位置（分段 id 与偏移），用于没有 seq 的旧条目排序，不写入存储
+	pos int64
+}
+
+// events 返回条目代表的事件数
+func (e *LogEntry) events() int {
+	if e.Count > 0 {
+		return e.Count
+	}
+	return 1
+}
+
+// fd 返回条目的 fd，未填写时返回 -1
+func (e *LogEntry) fd() int {
+	if e.Fd == nil {
+		return -1
+	}
+	return *e.Fd
 }
 
 // MapInfo URI映射信息
@@ -42,11 +78,32 @@ type MapInfo struct {
 // Logger 日志管理器
 type Logger struct {
 	baseDir      string
-	logFile      string
+	store        *logStore
 	maxSizeBytes int64
 	mu           sync.Mutex
 	buffer       []LogEntry
 	lastFlush    time.Time
+	seq          int64 // 最近分配的序号，启动时从已有日志恢复
+	policy       logPolicy
+	filtered     int64 // 因写入策略丢弃的条目数
+	throttle     logThrottle
+	journal      *logJournal
+	recovered    int    // 启动时从预写文件恢复的条目数
+	journalErr   string // 最近一次写预写文件的错误
+	integ        *logIntegrity
+	dlog         *DaemonLog
+	alerts       *AlertManager
+	redact       *logRedactor
+
+	// 串行化刷新，保证预写文件按代删除时对应的条目已写入存储
+	flushMu sync.Mutex
+	// 条目尚未写入存储的旧预写文件（写入存储失败时保留，由 mu 保护）
+	pendingJournals []string
+
+	// log.follow 订阅者
+	subMu     sync.RWMutex
+	subs      map[int64]*LogSubscription
+	nextSubID int64
 }
 
 // NewLogger 创建日志管理器
@@ -55,18 +112,83 @@ func NewLogger(baseDir string) (*Logger, error) {
 		return nil, err
 	}
 
-	// 统一日志文件路径
-	logFile := filepath.Join(baseDir, "access.log")
+	removeStaleExports(baseDir)
+
+	// 分段存储（旧版 access.log 会被迁移为第一个分段）
+	store, err := openLogStore(baseDir)
+	if err != nil {
+		return nil, err
+	}
+
+	integ, err := openLogIntegrity(baseDir, store)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	// 重放上次未刷新的缓冲区
+	journal, recovered, err := openLogJournal(baseDir, store, integ)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	dlog, err := openDaemonLog(baseDir)
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	alerts, err := openAlertManager(baseDir, dlog)
+	if err != nil {
+		dlog.Close()
+		store.Close()
+		return nil, err
+	}
 
 	return &Logger{
 		baseDir:      baseDir,
-		logFile:      logFile,
+		store:        store,
 		maxSizeBytes: 64 * 1024 * 1024, // 默认64MB
 		buffer:       make([]LogEntry, 0, 100),
 		lastFlush:    time.Now(),
+		seq:          max(store.LastSeq(), integ.maxCpSeq, readSeqMark(baseDir)),
+		policy:       defaultLogPolicy,
+		throttle:     newLogThrottle(),
+		journal:      journal,
+		recovered:    recovered,
+		integ:        integ,
+		dlog:         dlog,
+		alerts:       alerts,
+		redact:       &logRedactor{},
+		subs:         make(map[int64]*LogSubscription),
 	}, nil
 }
 
+// seqMarkFile 已分配序号的高水位，清空或删除日志后重启时序号不会回退
+const seqMarkFile = "seq.mark"
+
+func readSeqMark(dir string) int64 {
+	data, err := os.ReadFile(filepath.Join(dir, seqMarkFile))
+	if err != nil {
+		return 0
+	}
+	seq, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return seq
+}
+
+// saveSeqMark 在删除条目前记录序号高水位
+func (l *Logger) saveSeqMark(seq int64) error {
+	path := filepath.Join(l.baseDir, seqMarkFile)
+	if readSeqMark(l.baseDir) >= seq {
+		return nil
+	}
+	if err := os.WriteFile(path+".tmp", []byte(strconv.FormatInt(seq, 10)+"\n"), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
 // SetMaxSize 设置最大日志大小
 func (l *Logger) SetMaxSize(mb int) {
 	l.mu.Lock()
@@ -76,15 +198,44 @@ func (l *Logger) SetMaxSize(mb int) {
 
 // Write 写入日志条目
 func (l *Logger) Write(entry *LogEntry) error {
+	now := time.Now()
 	if entry.Ts == 0 {
-		entry.Ts = time.Now().UnixMilli()
+		entry.Ts = now.UnixMilli()
 	}
 
+	// 写入时脱敏先于告警与推送，敏感内容不会出现在告警记录和订阅者中
+	l.redact.apply(entry)
+
+	// 告警按到达的原始事件统计，不受写入策略、去重与限流影响
+	l.alerts.Evaluate(entry, now)
+
 	l.mu.Lock()
-	l.buffer = append(l.buffer, *entry)
+	if !l.policy.keep(entry) {
+		l.filtered++
+		l.mu.Unlock()
+		return nil
+	}
+	if l.mergeDuplicateLocked(entry) || !l.allowLocked(entry, now) {
+		l.mu.Unlock()
+		return nil
+	}
+	// 应用恢复写入时先记录之前被限流丢弃的事件汇总
+	summary := l.takeSummaryLocked(entry.Pkg)
+	if summary != nil {
+		l.appendLocked(summary)
+	}
+	l.appendLocked(entry)
+	if l.throttle.cfg.DedupWindowMs > 0 {
+		l.throttle.dedup[dedupKey(entry)] = len(l.buffer) - 1
+	}
 	shouldFlush := len(l.buffer) >= 100 || time.Since(l.lastFlush) > 5*time.Second
 	l.mu.Unlock()
 
+	if summary != nil {
+		l.publish(summary)
+	}
+	l.publish(entry)
+
 	if shouldFlush {
 		return l.Flush()
 	}
@@ -92,191 +243,162 @@ func (l *Logger) Write(entry *LogEntry) error {
 	return nil
 }
 
+// appendLocked 分配序号、写入预写文件并放入缓冲区（已加锁）
+//
+// 去重时对缓冲区内条目 count 的累加不写入预写文件，崩溃恢复后计数可能偏小。
+func (l *Logger) appendLocked(entry *LogEntry) {
+	l.seq++
+	entry.Seq = l.seq
+	if err := l.journal.append(entry); err != nil {
+		l.journalErr = err.Error()
+	}
+	l.buffer = append(l.buffer, *entry)
+}
+
 // Flush 刷新日志到文件
 func (l *Logger) Flush() error {
+	l.flushMu.Lock()
+	defer l.flushMu.Unlock()
+
 	l.mu.Lock()
+	summaries := l.takeAllSummariesLocked()
+	for _, s := range summaries {
+		l.appendLocked(s)
+	}
 	if len(l.buffer) == 0 {
 		l.mu.Unlock()
+		// 没有新条目时也应用完整性模式的开关
+		l.integ.link(nil)
 		return nil
 	}
 
 	entries := make([]LogEntry, len(l.buffer))
 	copy(entries, l.buffer)
 	l.buffer = l.buffer[:0]
+	clear(l.throttle.dedup)
 	l.lastFlush = time.Now()
+	oldJournal := l.journal.rotate()
+	syncStore := l.journal.fsync != fsyncNever
 	l.mu.Unlock()
 
-	return l.writeToFile(entries)
-}
-
-// FlushAll 刷新所有日志（兼容旧接口）
-func (l *Logger) FlushAll() error {
-	return l.Flush()
-}
+	for _, s := range summaries {
+		l.publish(s)
+	}
 
-func (l *Logger) writeToFile(entries []LogEntry) error {
-	f, err := os.OpenFile(l.logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
-	if err != nil {
+	// 写入失败时未写入的条目放回缓冲区头部，下次刷新时重试；
+	// 预写文件保留到条目写入存储为止，期间崩溃时启动后恢复
+	l.integ.link(entries)
+	if err := l.store.Append(entries); err != nil {
+		l.integ.resync(l.store)
+		l.requeue(entries, oldJournal)
 		return err
 	}
-	defer f.Close()
-
-	w := bufio.NewWriter(f)
-	for _, entry := range entries {
-		data, err := json.Marshal(entry)
-		if err != nil {
-			continue
+	if syncStore {
+		if err := l.store.Sync(); err != nil {
+			return err
 		}
-		w.Write(data)
-		w.WriteByte('\n')
 	}
+	l.integ.committed(false)
 
-	return w.Flush()
-}
-
-// Query 查询日志
-func (l *Logger) Query(pkg string, from, to int64, ops []string, contains string, limit, offset int) ([]LogEntry, int, error) {
-	// 先刷新缓冲区
-	l.Flush()
-
-	var allEntries []LogEntry
-
-	// 读取统一日志文件
-	if _, err := os.Stat(l.logFile); !os.IsNotExist(err) {
-		entries, err := l.readLogFile(l.logFile)
-		if err != nil {
-			return nil, 0, err
+	l.mu.Lock()
+	pending := l.pendingJournals
+	l.pendingJournals = nil
+	l.mu.Unlock()
+	for _, path := range append(pending, oldJournal) {
+		if path != "" {
+			os.Remove(path)
 		}
-		allEntries = append(allEntries, entries...)
 	}
+	return nil
+}
 
-	// 过滤
-	var filtered []LogEntry
-	for _, entry := range allEntries {
-		// 包名过滤
-		if pkg != "" && entry.Pkg != pkg {
-			continue
-		}
+// requeue 将写入存储失败的条目放回缓冲区头部（已写入的部分除外），并保留其预写文件
+func (l *Logger) requeue(entries []LogEntry, journal string) {
+	lastSeq := l.store.LastSeq()
 
-		// 时间过滤
-		if from > 0 && entry.Ts < from {
-			continue
-		}
-		if to > 0 && entry.Ts > to {
-			continue
-		}
+	l.mu.Lock()
+	defer l.mu.Unlock()
 
-		// 操作类型过滤
-		if len(ops) > 0 {
-			found := false
-			for _, op := range ops {
-				if entry.Op == op {
-					found = true
-					break
-				}
-			}
-			if !found {
-				continue
-			}
+	pending := make([]LogEntry, 0, len(entries)+len(l.buffer))
+	for _, e := range entries {
+		if e.Seq > lastSeq {
+			pending = append(pending, e)
 		}
-
-		// 内容过滤
-		if contains != "" {
-			data, _ := json.Marshal(entry)
-			if !strings.Contains(string(data), contains) {
-				continue
-			}
-		}
-
-		filtered = append(filtered, entry)
 	}
+	l.buffer = append(pending, l.buffer...)
+	// 缓冲区下标已变化
+	clear(l.throttle.dedup)
+	if journal != "" {
+		l.pendingJournals = append(l.pendingJournals, journal)
+	}
+}
 
-	// 按时间排序（降序）
-	sort.Slice(filtered, func(i, j int) bool {
-		return filtered[i].Ts > filtered[j].Ts
-	})
-
-	total := len(filtered)
+// FlushAll 刷新所有日志（兼容旧接口）
+func (l *Logger) FlushAll() error {
+	return l.Flush()
+}
 
-	// 分页
-	if offset >= total {
-		return []LogEntry{}, total, nil
-	}
+// Query 查询日志，按时间降序分页，同时返回匹配总数
+func (l *Logger) Query(filter LogFilter, limit, offset int) ([]LogEntry, int, error) {
+	// 先刷新缓冲区
+	l.Flush()
 
-	end := offset + limit
-	if end > total {
-		end = total
+	if offset < 0 {
+		offset = 0
 	}
 
-	return filtered[offset:end], total, nil
-}
-
-func (l *Logger) readLogFile(path string) ([]LogEntry, error) {
-	f, err := os.Open(path)
+	entries, total, err := l.store.Collect(&filter, offset+limit, true)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	defer f.Close()
 
-	var entries []LogEntry
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-
-		var entry LogEntry
-		if err := json.Unmarshal([]byte(line), &entry); err != nil {
-			continue // 跳过损坏的行
-		}
-		entries = append(entries, entry)
+	if offset >= len(entries) {
+		return []LogEntry{}, total, nil
 	}
+	return entries[offset:], total, nil
+}
 
-	return entries, scanner.Err()
+// PkgCount 单个应用的匹配条目数
+type PkgCount struct {
+	Pkg   string `json:"pkg"`
+	Count int    `json:"count"`
 }
 
-// Tail 获取最近的日志
-func (l *Logger) Tail(pkg string, n int) ([]LogEntry, error) {
-	// 先刷新缓冲区
+// CountByPkg 按应用统计匹配条目数，按数量降序
+func (l *Logger) CountByPkg(filter LogFilter) ([]PkgCount, error) {
 	l.Flush()
 
-	// 读取统一日志文件
-	if _, err := os.Stat(l.logFile); os.IsNotExist(err) {
-		return []LogEntry{}, nil
-	}
-
-	entries, err := l.readLogFile(l.logFile)
+	counts, err := l.store.CountByPkg(&filter)
 	if err != nil {
 		return nil, err
 	}
 
-	// 如果指定了包名，进行过滤
-	if pkg != "" {
-		var filtered []LogEntry
-		for _, entry := range entries {
-			if entry.Pkg == pkg {
-				filtered = append(filtered, entry)
-			}
-		}
-		entries = filtered
+	result := make([]PkgCount, 0, len(counts))
+	for pkg, n := range counts {
+		result = append(result, PkgCount{Pkg: pkg, Count: n})
 	}
-
-	// 按时间降序排序
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Ts > entries[j].Ts
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Pkg < result[j].Pkg
 	})
+	return result, nil
+}
 
-	if len(entries) > n {
-		entries = entries[:n]
-	}
+// Tail 获取最近的日志（从最新的数据块开始读取），pkg 为空时不按应用过滤
+func (l *Logger) Tail(pkg string, n int) ([]LogEntry, error) {
+	// 先刷新缓冲区
+	l.Flush()
 
-	return entries, nil
+	entries, _, err := l.store.Collect(&LogFilter{Pkg: pkg}, n, false)
+	return entries, err
 }
 
-// Clear 清空日志
+// Clear 清空日志，pkg 为空时清空全部
 func (l *Logger) Clear(pkg string) error {
 	l.mu.Lock()
+	buffered := len(l.buffer)
 	// 清空缓冲区
 	if pkg == "" {
 		// 清空所有
@@ -291,143 +413,160 @@ func (l *Logger) Clear(pkg string) error {
 		}
 		l.buffer = newBuffer
 	}
-	l.mu.Unlock()
-
-	// 清空文件
-	if pkg == "" {
-		// 清空所有日志
-		return os.RemoveAll(l.logFile)
-	}
-
-	// 读取并过滤，然后写回
-	entries, err := l.readLogFile(l.logFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
+	clear(l.throttle.dedup)
+	// 预写文件只保留缓冲区中剩余的条目，避免已清空的日志在崩溃恢复时重新出现
+	if old := l.journal.rotate(); old != "" || len(l.pendingJournals) > 0 {
+		for i := range l.buffer {
+			l.journal.append(&l.buffer[i])
 		}
-		return err
-	}
-
-	var filtered []LogEntry
-	for _, entry := range entries {
-		if entry.Pkg != pkg {
-			filtered = append(filtered, entry)
+		for _, path := range append(l.pendingJournals, old) {
+			if path != "" {
+				os.Remove(path)
+			}
 		}
+		l.pendingJournals = nil
 	}
+	removed := buffered - len(l.buffer)
+	seq := l.seq
+	l.mu.Unlock()
 
-	// 写回文件
-	tmpFile := l.logFile + ".tmp"
-	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
-	if err != nil {
+	if err := l.saveSeqMark(seq); err != nil {
 		return err
 	}
 
-	w := bufio.NewWriter(f)
-	for _, entry := range filtered {
-		data, err := json.Marshal(entry)
-		if err != nil {
-			continue
+	if pkg == "" {
+		n := l.store.Stats().Entries
+		err := l.store.RemoveAll()
+		if err == nil {
+			removed += n
 		}
-		w.Write(data)
-		w.WriteByte('\n')
+		l.integ.prune(seq, removed, "clear")
+		return err
 	}
-	w.Flush()
-	f.Close()
 
-	return os.Rename(tmpFile, l.logFile)
+	// 只重写包含该包日志的分段
+	n, err := l.store.RemoveWhere(&LogFilter{Pkg: pkg})
+	l.integ.prune(seq, removed+n, "clear pkg="+pkg)
+	return err
 }
 
-// Cleanup 清理超过大小限制的日志
-func (l *Logger) Cleanup() error {
-	// 先刷新所有日志
-	l.Flush()
+// SetRotation 设置分段切换策略（daily 模式下跨天切换，任何模式下超过大小都会切换）
+func (l *Logger) SetRotation(daily bool, segmentBytes int64) {
+	l.store.Configure(daily, segmentBytes)
+}
 
-	// 获取文件信息
-	info, err := os.Stat(l.logFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil
-		}
-		return err
-	}
+// SetEncoding 设置新分段的编码（已有分段保持原编码，可用 Convert 转换）
+func (l *Logger) SetEncoding(binary bool) {
+	l.store.SetEncoding(binary)
+}
 
-	if info.Size() <= l.maxSizeBytes {
-		return nil
-	}
+// Convert 将已有分段转换为指定编码，返回转换的分段数及转换前后占用的字节数
+func (l *Logger) Convert(binary bool) (int, int64, int64, error) {
+	l.Flush()
+	return l.store.Convert(binary)
+}
 
-	// 读取所有日志
-	entries, err := l.readLogFile(l.logFile)
-	if err != nil {
-		return err
-	}
+// Compress 压缩最晚条目早于 before 的分段，返回压缩的分段数
+func (l *Logger) Compress(before time.Time) (int, error) {
+	return l.store.CompressBefore(before)
+}
 
-	// 按时间排序
-	sort.Slice(entries, func(i, j int) bool {
-		return entries[i].Ts < entries[j].Ts
-	})
+// Cleanup 删除最旧的分段直到总大小不超过限制，返回删除的分段数
+func (l *Logger) Cleanup() (int, error) {
+	// 先刷新所有日志
+	l.Flush()
 
-	// 删除最旧的日志直到满足限制（保留最新的 80%）
-	keepCount := int(float64(len(entries)) * 0.8)
-	if keepCount < 100 {
-		keepCount = 100
-	}
-	entries = entries[len(entries)-keepCount:]
+	l.mu.Lock()
+	maxSize := l.maxSizeBytes
+	seq := l.seq
+	l.mu.Unlock()
 
-	// 写回文件
-	tmpFile := l.logFile + ".tmp"
-	f, err := os.OpenFile(tmpFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
-	if err != nil {
-		return err
+	if err := l.saveSeqMark(seq); err != nil {
+		return 0, err
 	}
 
-	w := bufio.NewWriter(f)
-	for _, entry := range entries {
-		data, err := json.Marshal(entry)
+	entries := l.store.Stats().Entries
+	removed := 0
+	defer func() {
+		if removed > 0 {
+			l.integ.prune(seq, entries-l.store.Stats().Entries, "maxLogSizeMB")
+		}
+	}()
+	for l.store.TotalSize() > maxSize {
+		_, ok, err := l.store.RemoveOldest()
 		if err != nil {
-			continue
+			return removed, err
+		}
+		if !ok {
+			break
 		}
-		w.Write(data)
-		w.WriteByte('\n')
+		removed++
 	}
-	w.Flush()
-	f.Close()
-
-	return os.Rename(tmpFile, l.logFile)
+	return removed, nil
 }
 
-// GetStats 获取日志统计
+// GetStats 获取日志统计（仅读取索引）
 func (l *Logger) GetStats() map[string]interface{} {
 	l.Flush()
 
-	info, err := os.Stat(l.logFile)
-	if err != nil {
-		return map[string]interface{}{
-			"totalSizeBytes": 0,
-			"maxSizeBytes":   l.maxSizeBytes,
-			"appCount":       0,
-		}
-	}
+	st := l.store.Stats()
 
-	// 统计应用数量
-	entries, _ := l.readLogFile(l.logFile)
-	appCount := make(map[string]bool)
-	for _, entry := range entries {
-		appCount[entry.Pkg] = true
-	}
+	l.mu.Lock()
+	maxSize := l.maxSizeBytes
+	l.mu.Unlock()
 
 	return map[string]interface{}{
-		"totalSizeBytes": info.Size(),
-		"maxSizeBytes":   l.maxSizeBytes,
-		"appCount":       len(appCount),
+		"baseDir":        l.baseDir,
+		"totalSizeBytes": l.store.TotalSize(),
+		"maxSizeBytes":   maxSize,
+		"appCount":       len(st.Pkgs),
+		"entryCount":     st.Entries,
+		"segmentCount":   st.Segments,
+		"oldestTs":       st.Oldest,
+		"newestTs":       st.Newest,
+		"followers":      l.SubscriberCount(),
+		"logging":        l.loggingStatus(),
+		"integrity":      l.integ.status(),
 	}
 }
 
 // Close 关闭日志管理器
 func (l *Logger) Close() error {
-	return l.Flush()
+	err := l.Flush()
+	// 退出前为链尾生成检查点
+	l.integ.committed(true)
+
+	l.mu.Lock()
+	l.journal.close(err == nil && len(l.buffer) == 0)
+	l.mu.Unlock()
+
+	l.store.Close()
+	l.alerts.Close()
+	l.dlog.Close()
+	return err
 }
 
-// Printf 打印日志（用于daemon自身日志）
+// Printf 以 info 级别记录守护进程日志（兼容旧接口）
 func (l *Logger) Printf(format string, v ...interface{}) {
-	fmt.Fprintf(os.Stderr, "[%s] %s\n", time.Now().Format("2006-01-02 15:04:05"), fmt.Sprintf(format, v...))
+	l.dlog.Log("info", "daemon", format, v...)
+}
+
+// Debugf 记录 debug 级别的守护进程日志，component 标明来源模块
+func (l *Logger) Debugf(component, format string, v ...interface{}) {
+	l.dlog.Log("debug", component, format, v...)
+}
+
+// Infof 记录 info 级别的守护进程日志
+func (l *Logger) Infof(component, format string, v ...interface{}) {
+	l.dlog.Log("info", component, format, v...)
+}
+
+// Warnf 记录 warn 级别的守护进程日志
+func (l *Logger) Warnf(component, format string, v ...interface{}) {
+	l.dlog.Log("warn", component, format, v...)
+}
+
+// Errorf 记录 error 级别的守护进程日志
+func (l *Logger) Errorf(component, format string, v ...interface{}) {
+	l.dlog.Log("error", component, format, v...)
 }
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+)
+
+// logLevels 访问日志级别，级别越高记录的条目越少
+//
+//	debug/info 记录全部条目
+//	warn       只记录拒绝（DENY_*）与重定向（REDIRECT）
+//	error      只记录拒绝
+var logLevels = map[string]bool{"debug": true, "info": true, "warn": true, "error": true}
+
+// 生效的记录模式（status.logs.logging.mode）
+const (
+	logModeAll             = "all"
+	logModeDenyAndRedirect = "denyAndRedirect"
+	logModeDenyOnly        = "denyOnly"
+)
+
+// logPolicy 访问日志写入策略，由 GlobalConfig.MonitorEnabled 与 LogLevel 决定
+//
+// 关闭监控时不再记录普通监控条目，但拒绝与重定向事件始终保留（级别为 error 时只保留拒绝），
+// 便于排查应用写入失败与文件去向。
+type logPolicy struct {
+	MonitorEnabled bool
+	Level          string
+}
+
+// defaultLogPolicy 与默认全局配置一致
+var defaultLogPolicy = logPolicy{MonitorEnabled: true, Level: "info"}
+
+// Mode 返回生效的记录模式
+func (p logPolicy) Mode() string {
+	if p.Level == "error" {
+		return logModeDenyOnly
+	}
+	if !p.MonitorEnabled || p.Level == "warn" {
+		return logModeDenyAndRedirect
+	}
+	return logModeAll
+}
+
+// keep 判断条目是否需要记录
+func (p logPolicy) keep(e *LogEntry) bool {
+	switch p.Mode() {
+	case logModeDenyOnly:
+		return isDenyDecision(e.Decision)
+	case logModeDenyAndRedirect:
+		return isDenyDecision(e.Decision) || e.Decision == "REDIRECT"
+	}
+	return true
+}
+
+func isDenyDecision(decision string) bool {
+	return strings.HasPrefix(decision, "DENY_")
+}
+
+// SetPolicy 设置写入策略，未知级别按 info 处理
+func (l *Logger) SetPolicy(monitorEnabled bool, level string) {
+	if !logLevels[level] {
+		level = "info"
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.policy = logPolicy{MonitorEnabled: monitorEnabled, Level: level}
+}
+
+// WatchConfig 应用全局配置中的写入策略、去重限流参数、完整性模式、守护进程日志配置、告警规则与脱敏规则，并在配置变更后重新应用
+func (l *Logger) WatchConfig(cm *ConfigManager) {
+	apply := func() {
+		global := cm.GetGlobalConfig()
+		l.SetPolicy(global.MonitorEnabled, global.LogLevel)
+		l.SetThrottle(global.LogThrottle)
+		l.integ.configure(global.LogIntegrity)
+		l.dlog.Configure(global.DaemonLog)
+		l.alerts.SetRules(global.Alerts)
+		l.SetRedaction(global.Redaction)
+	}
+	apply()
+	cm.Watch(func(int) { apply() })
+}
+
+// loggingStatus 返回写入策略、去重限流参数及被过滤/合并/限流的事件数（对应 status.logs.logging）
+func (l *Logger) loggingStatus() map[string]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return map[string]interface{}{
+		"monitorEnabled": l.policy.MonitorEnabled,
+		"logLevel":       l.policy.Level,
+		"mode":           l.policy.Mode(),
+		"filtered":       l.filtered,
+		"throttle":       l.throttle.cfg,
+		"deduplicated":   l.throttle.deduplicated,
+		"suppressed":     l.throttle.suppressed,
+		"redaction":      l.redact.status(),
+	}
+}
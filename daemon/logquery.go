@@ -0,0 +1,588 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// LogQuery 编译后的日志查询表达式
+//
+// 语法：
+//
+//	expr  := term { "or" term }
+//	term  := factor { "and" factor }
+//	factor:= "not" factor | "(" expr ")" | field op value | field "in" "(" value {"," value} ")"
+//	op    := "=" | "!=" | "~" | "!~" | "=~" | "^=" | ">" | ">=" | "<" | "<="
+//
+// 字段：ts pid tid uid errno fd openId ino dev bytes（数值），pkg proc op path uri mapped decision result、
+// map.status map.method map.detail、rule.<key>、extra.<key>（字符串）。
+// "~" 为路径通配（** 匹配任意层级，* 和 ? 不跨越 /），模式未以 ** 开头时可匹配
+// 路径中任意以 / 开始的后缀；"=~" 为正则；"^=" 为前缀。
+// ts 的值可以是毫秒时间戳，也可以是 -1h、-30m 这样相对当前时间的偏移。
+// 没有 errno 的条目视为 errno=0。
+type LogQuery struct {
+	source string
+	root   queryNode
+	hint   LogFilter // 从顶层 and 条件中提取的索引过滤条件
+}
+
+// String 返回原始表达式
+func (q *LogQuery) String() string {
+	return q.source
+}
+
+// Match 判断条目是否满足表达式
+func (q *LogQuery) Match(entry *LogEntry) bool {
+	return q.root.eval(entry)
+}
+
+// QueryError 查询表达式错误，Pos 为出错位置（字节偏移）
+type QueryError struct {
+	Pos     int
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("at %d: %s", e.Pos, e.Message)
+}
+
+// ParseLogQuery 解析查询表达式
+func ParseLogQuery(src string) (*LogQuery, error) {
+	tokens, err := lexQuery(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens, now: time.Now()}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, &QueryError{Pos: tok.pos, Message: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+
+	q := &LogQuery{source: src, root: root}
+	collectHints(root, &q.hint)
+	return q, nil
+}
+
+// 节点
+
+type queryNode interface {
+	eval(entry *LogEntry) bool
+}
+
+type andNode struct{ left, right queryNode }
+
+func (n *andNode) eval(e *LogEntry) bool { return n.left.eval(e) && n.right.eval(e) }
+
+type orNode struct{ left, right queryNode }
+
+func (n *orNode) eval(e *LogEntry) bool { return n.left.eval(e) || n.right.eval(e) }
+
+type notNode struct{ inner queryNode }
+
+func (n *notNode) eval(e *LogEntry) bool { return !n.inner.eval(e) }
+
+// cmpNode 字段比较
+type cmpNode struct {
+	field   string
+	op      string
+	numeric bool
+	strs    []string
+	nums    []int64
+	re      *regexp.Regexp
+}
+
+func (n *cmpNode) eval(e *LogEntry) bool {
+	if n.numeric {
+		v := numericField(e, n.field)
+		switch n.op {
+		case "=", "in":
+			for _, x := range n.nums {
+				if v == x {
+					return true
+				}
+			}
+			return false
+		case "!=":
+			return v != n.nums[0]
+		case ">":
+			return v > n.nums[0]
+		case ">=":
+			return v >= n.nums[0]
+		case "<":
+			return v < n.nums[0]
+		case "<=":
+			return v <= n.nums[0]
+		}
+		return false
+	}
+
+	v := stringField(e, n.field)
+	switch n.op {
+	case "=", "in":
+		return containsString(n.strs, v)
+	case "!=":
+		return v != n.strs[0]
+	case "^=":
+		return strings.HasPrefix(v, n.strs[0])
+	case "~", "=~":
+		return n.re.MatchString(v)
+	case "!~":
+		return !n.re.MatchString(v)
+	}
+	return false
+}
+
+var numericFields = map[string]bool{
+	"ts": true, "pid": true, "tid": true, "uid": true, "errno": true,
+	"fd": true, "openId": true, "ino": true, "dev": true, "bytes": true,
+}
+
+var stringFields = map[string]bool{
+	"pkg": true, "proc": true, "op": true, "path": true, "uri": true, "mapped": true,
+	"decision": true, "result": true, "map.status": true, "map.method": true, "map.detail": true,
+}
+
+// fieldNames 小写字段名到内置字段名的映射，内置字段名不区分大小写
+var fieldNames = func() map[string]string {
+	names := make(map[string]string)
+	for _, table := range []map[string]bool{numericFields, stringFields} {
+		for f := range table {
+			names[strings.ToLower(f)] = f
+		}
+	}
+	return names
+}()
+
+// canonicalField 规范化字段名：rule. 与 extra. 只有前缀不区分大小写，其后的键名保持原样
+func canonicalField(name string) string {
+	lower := strings.ToLower(name)
+	for _, prefix := range []string{"rule.", "extra."} {
+		if strings.HasPrefix(lower, prefix) {
+			return prefix + name[len(prefix):]
+		}
+	}
+	if f, ok := fieldNames[lower]; ok {
+		return f
+	}
+	return name
+}
+
+func validField(field string) bool {
+	return numericFields[field] || stringFields[field] ||
+		strings.HasPrefix(field, "rule.") || strings.HasPrefix(field, "extra.")
+}
+
+func numericField(e *LogEntry, field string) int64 {
+	switch field {
+	case "ts":
+		return e.Ts
+	case "pid":
+		return int64(e.Pid)
+	case "tid":
+		return int64(e.Tid)
+	case "uid":
+		return int64(e.Uid)
+	case "errno":
+		if e.Errno == nil {
+			return 0
+		}
+		return int64(*e.Errno)
+	case "fd":
+		return int64(e.fd())
+	case "openId":
+		return e.OpenID
+	case "ino":
+		return int64(e.Ino)
+	case "dev":
+		return int64(e.Dev)
+	case "bytes":
+		return e.Bytes
+	}
+	return 0
+}
+
+func stringField(e *LogEntry, field string) string {
+	switch field {
+	case "pkg":
+		return e.Pkg
+	case "proc":
+		return e.Proc
+	case "op":
+		return e.Op
+	case "path":
+		return e.Path
+	case "uri":
+		return e.URI
+	case "mapped":
+		return e.Mapped
+	case "decision":
+		return e.Decision
+	case "result":
+		return e.Result
+	case "map.status", "map.method", "map.detail":
+		if e.Map == nil {
+			return ""
+		}
+		switch field {
+		case "map.status":
+			return e.Map.Status
+		case "map.method":
+			return e.Map.Method
+		}
+		return e.Map.Detail
+	}
+
+	if key, ok := strings.CutPrefix(field, "rule."); ok {
+		return mapValue(e.Rule, key)
+	}
+	if key, ok := strings.CutPrefix(field, "extra."); ok {
+		return mapValue(e.Extra, key)
+	}
+	return ""
+}
+
+func mapValue(m map[string]interface{}, key string) string {
+	v, ok := m[key]
+	if !ok || v == nil {
+		return ""
+	}
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// collectHints 从顶层 and 链中提取可用于跳过数据块的必要条件
+func collectHints(node queryNode, hint *LogFilter) {
+	switch n := node.(type) {
+	case *andNode:
+		collectHints(n.left, hint)
+		collectHints(n.right, hint)
+	case *cmpNode:
+		switch {
+		case n.field == "pkg" && n.op == "=" && hint.Pkg == "":
+			hint.Pkg = n.strs[0]
+		case n.field == "op" && (n.op == "=" || n.op == "in") && len(hint.Ops) == 0:
+			hint.Ops = n.strs
+		case n.field == "decision" && (n.op == "=" || n.op == "in") && len(hint.Decisions) == 0:
+			hint.Decisions = n.strs
+		case n.field == "ts":
+			switch n.op {
+			case ">", ">=":
+				if n.nums[0] > hint.From {
+					hint.From = n.nums[0]
+				}
+			case "<", "<=":
+				if hint.To == 0 || n.nums[0] < hint.To {
+					hint.To = n.nums[0]
+				}
+			}
+		}
+	}
+}
+
+// globToRegexp 将路径通配转换为正则
+func globToRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	if !strings.HasPrefix(pattern, "**") {
+		if strings.HasPrefix(pattern, "/") {
+			b.WriteString("(?:.*)?")
+		} else {
+			b.WriteString("(?:.*/)?")
+		}
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// 词法分析
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+)
+
+type queryToken struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+func lexQuery(src string) ([]queryToken, error) {
+	var tokens []queryToken
+	i := 0
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{tokRParen, ")", i})
+			i++
+		case c == ',':
+			tokens = append(tokens, queryToken{tokComma, ",", i})
+			i++
+		case c == '"' || c == '\'':
+			start := i
+			quote := c
+			var b strings.Builder
+			i++
+			closed := false
+			for i < len(src) {
+				if src[i] == '\\' && i+1 < len(src) {
+					b.WriteByte(src[i+1])
+					i += 2
+					continue
+				}
+				if src[i] == quote {
+					closed = true
+					i++
+					break
+				}
+				b.WriteByte(src[i])
+				i++
+			}
+			if !closed {
+				return nil, &QueryError{Pos: start, Message: "unterminated string"}
+			}
+			tokens = append(tokens, queryToken{tokString, b.String(), start})
+		case strings.IndexByte("=!~<>^", c) >= 0:
+			start := i
+			op := string(c)
+			if i+1 < len(src) {
+				two := src[i : i+2]
+				switch two {
+				case "!=", "!~", "=~", "^=", ">=", "<=":
+					op = two
+				}
+			}
+			if op == "!" || op == "^" {
+				return nil, &QueryError{Pos: start, Message: fmt.Sprintf("unknown operator %q", op)}
+			}
+			i += len(op)
+			tokens = append(tokens, queryToken{tokOp, op, start})
+		default:
+			start := i
+			for i < len(src) && !isQueryDelimiter(rune(src[i])) {
+				i++
+			}
+			tokens = append(tokens, queryToken{tokWord, src[start:i], start})
+		}
+	}
+	tokens = append(tokens, queryToken{tokEOF, "", len(src)})
+	return tokens, nil
+}
+
+func isQueryDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || strings.ContainsRune("(),=!~<>^\"'", r)
+}
+
+// 语法分析
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	now    time.Time
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *queryParser) isKeyword(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokWord && strings.EqualFold(tok.text, word)
+}
+
+func (p *queryParser) parseExpr() (queryNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseTerm() (queryNode, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = &andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseFactor() (queryNode, error) {
+	if p.isKeyword("not") {
+		p.next()
+		inner, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{inner}, nil
+	}
+
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		node, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, &QueryError{Pos: closing.pos, Message: "expected )"}
+		}
+		return node, nil
+	case tokWord:
+		return p.parseComparison(tok)
+	case tokEOF:
+		return nil, &QueryError{Pos: tok.pos, Message: "unexpected end of expression"}
+	}
+	return nil, &QueryError{Pos: tok.pos, Message: fmt.Sprintf("expected field name, got %q", tok.text)}
+}
+
+func (p *queryParser) parseComparison(fieldTok queryToken) (queryNode, error) {
+	field := canonicalField(fieldTok.text)
+	if !validField(field) {
+		return nil, &QueryError{Pos: fieldTok.pos, Message: fmt.Sprintf("unknown field %q", fieldTok.text)}
+	}
+	node := &cmpNode{field: field, numeric: numericFields[field]}
+
+	var values []queryToken
+	opTok := p.next()
+	switch {
+	case opTok.kind == tokOp:
+		node.op = opTok.text
+		v := p.next()
+		if v.kind != tokWord && v.kind != tokString {
+			return nil, &QueryError{Pos: v.pos, Message: fmt.Sprintf("expected value after %s", node.op)}
+		}
+		values = append(values, v)
+	case opTok.kind == tokWord && strings.EqualFold(opTok.text, "in"):
+		node.op = "in"
+		if open := p.next(); open.kind != tokLParen {
+			return nil, &QueryError{Pos: open.pos, Message: "expected ( after in"}
+		}
+		for {
+			v := p.next()
+			if v.kind != tokWord && v.kind != tokString {
+				return nil, &QueryError{Pos: v.pos, Message: "expected value in list"}
+			}
+			values = append(values, v)
+			sep := p.next()
+			if sep.kind == tokRParen {
+				break
+			}
+			if sep.kind != tokComma {
+				return nil, &QueryError{Pos: sep.pos, Message: "expected , or )"}
+			}
+		}
+	default:
+		return nil, &QueryError{Pos: opTok.pos, Message: fmt.Sprintf("expected operator after %s", field)}
+	}
+
+	if node.numeric {
+		switch node.op {
+		case "~", "!~", "=~", "^=":
+			return nil, &QueryError{Pos: opTok.pos, Message: fmt.Sprintf("operator %s is not valid for numeric field %s", node.op, field)}
+		}
+		for _, v := range values {
+			n, err := p.parseNumber(field, v.text)
+			if err != nil {
+				return nil, &QueryError{Pos: v.pos, Message: err.Error()}
+			}
+			node.nums = append(node.nums, n)
+		}
+		return node, nil
+	}
+
+	switch node.op {
+	case ">", ">=", "<", "<=":
+		return nil, &QueryError{Pos: opTok.pos, Message: fmt.Sprintf("operator %s is only valid for numeric fields", node.op)}
+	}
+	for _, v := range values {
+		node.strs = append(node.strs, v.text)
+	}
+
+	var err error
+	switch node.op {
+	case "~", "!~":
+		node.re, err = globToRegexp(node.strs[0])
+	case "=~":
+		node.re, err = regexp.Compile(node.strs[0])
+	}
+	if err != nil {
+		return nil, &QueryError{Pos: values[0].pos, Message: fmt.Sprintf("invalid pattern: %v", err)}
+	}
+	return node, nil
+}
+
+// parseNumber 解析数值，ts 额外支持相对当前时间的偏移（如 -1h）
+func (p *queryParser) parseNumber(field, text string) (int64, error) {
+	if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return n, nil
+	}
+	if field == "ts" && strings.HasPrefix(text, "-") {
+		if d, err := time.ParseDuration(text[1:]); err == nil {
+			return p.now.Add(-d).UnixMilli(), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid number %q for %s", text, field)
+}
@@ -0,0 +1,1509 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 分段存储参数
+const (
+	segmentPrefix       = "access."
+	segmentDataExt      = ".jsonl"
+	segmentBinaryExt    = ".srb"
+	segmentGzipExt      = ".gz"
+	segmentIndexExt     = ".idx"
+	defaultSegmentBytes = 4 * 1024 * 1024
+	maxBlockEntries     = 512
+)
+
+// blockIndex 一个数据块（一次批量写入）的索引
+//
+// 数据块是分段文件中一段连续的 JSONL 行，索引记录其位置、时间范围
+// 以及按包名/操作/决策分组的条目数，查询时据此跳过不相关的数据块。
+type blockIndex struct {
+	Off       int64            `json:"off"`
+	Len       int64            `json:"len"`
+	N         int              `json:"n"`
+	MinTs     int64            `json:"minTs"`
+	MaxTs     int64            `json:"maxTs"`
+	MaxSeq    int64            `json:"maxSeq,omitempty"`
+	Pkgs      map[string]int   `json:"pkgs"`
+	Ops       map[string]int   `json:"ops"`
+	Decisions map[string]int   `json:"decisions"`
+	PkgBytes  map[string]int64 `json:"pkgBytes,omitempty"`
+}
+
+// segment 日志分段文件及其索引
+//
+// 压缩后的分段（.jsonl.gz / .srb.gz）不再写入，块索引中的偏移仍指向解压后的数据。
+type segment struct {
+	id         int64
+	path       string
+	idxPath    string
+	size       int64 // 未压缩数据大小
+	diskSize   int64 // 压缩后文件大小（仅压缩分段）
+	idxSize    int64
+	compressed bool
+	binary     bool   // 二进制编码（.srb），否则为 JSONL
+	day        string // 分段开始写入的日期（daily 模式按此切换）
+	blocks     []*blockIndex
+}
+
+// bytesOnDisk 返回分段（含索引）占用的磁盘空间
+func (seg *segment) bytesOnDisk() int64 {
+	if seg.compressed {
+		return seg.diskSize + seg.idxSize
+	}
+	return seg.size + seg.idxSize
+}
+
+// name 返回分段数据文件名
+func (seg *segment) name() string {
+	return filepath.Base(seg.path)
+}
+
+// minTs 返回分段中最早的时间戳
+func (seg *segment) minTs() int64 {
+	var ts int64
+	for i, b := range seg.blocks {
+		if i == 0 || b.MinTs < ts {
+			ts = b.MinTs
+		}
+	}
+	return ts
+}
+
+// maxTs 返回分段中最晚的时间戳
+func (seg *segment) maxTs() int64 {
+	var ts int64
+	for _, b := range seg.blocks {
+		if b.MaxTs > ts {
+			ts = b.MaxTs
+		}
+	}
+	return ts
+}
+
+// count 返回分段中的条目数
+func (seg *segment) count() int {
+	n := 0
+	for _, b := range seg.blocks {
+		n += b.N
+	}
+	return n
+}
+
+// LogFilter 日志过滤条件
+type LogFilter struct {
+	Pkg        string
+	From       int64
+	To         int64
+	Ops        []string
+	Decisions  []string
+	Contains   string
+	PathPrefix string
+	Where      *LogQuery
+	After      *LogCursor // 只匹配排在游标之后的条目
+}
+
+// Match 判断条目是否满足过滤条件
+func (f *LogFilter) Match(entry *LogEntry) bool {
+	if f.Pkg != "" && entry.Pkg != f.Pkg {
+		return false
+	}
+	if f.From > 0 && entry.Ts < f.From {
+		return false
+	}
+	if f.To > 0 && entry.Ts > f.To {
+		return false
+	}
+	if len(f.Ops) > 0 && !containsString(f.Ops, entry.Op) {
+		return false
+	}
+	if len(f.Decisions) > 0 && !containsString(f.Decisions, entry.Decision) {
+		return false
+	}
+	if f.Contains != "" {
+		data, _ := json.Marshal(entry)
+		if !strings.Contains(string(data), f.Contains) {
+			return false
+		}
+	}
+	if f.PathPrefix != "" && !strings.HasPrefix(entry.Path, f.PathPrefix) {
+		return false
+	}
+	if f.Where != nil && !f.Where.Match(entry) {
+		return false
+	}
+	if f.After != nil && !f.After.After(entry) {
+		return false
+	}
+	return true
+}
+
+// mayMatch 根据块索引判断块中是否可能存在满足条件的条目
+func (f *LogFilter) mayMatch(b *blockIndex) bool {
+	if f.From > 0 && b.MaxTs < f.From {
+		return false
+	}
+	if f.To > 0 && b.MinTs > f.To {
+		return false
+	}
+	if f.Pkg != "" && b.Pkgs[f.Pkg] == 0 {
+		return false
+	}
+	if len(f.Ops) > 0 && sumCounts(b.Ops, f.Ops) == 0 {
+		return false
+	}
+	if len(f.Decisions) > 0 && sumCounts(b.Decisions, f.Decisions) == 0 {
+		return false
+	}
+	if f.Where != nil && !f.Where.hint.mayMatch(b) {
+		return false
+	}
+	if f.After != nil && b.MinTs > f.After.Ts {
+		return false
+	}
+	return true
+}
+
+// exactCount 仅凭块索引计算匹配条目数，无法精确计算时返回 false
+func (f *LogFilter) exactCount(b *blockIndex) (int, bool) {
+	if f.Contains != "" || f.PathPrefix != "" || f.Where != nil {
+		return 0, false
+	}
+	if (f.From > 0 && b.MinTs < f.From) || (f.To > 0 && b.MaxTs > f.To) {
+		return 0, false
+	}
+	if f.After != nil && b.MaxTs >= f.After.Ts {
+		return 0, false
+	}
+
+	// 每个维度要么不过滤、要么块内全部满足、要么给出该维度的计数；
+	// 只有一个维度需要计数时结果才是精确的
+	count := b.N
+	partial := 0
+	dims := []struct {
+		values []string
+		counts map[string]int
+	}{
+		{nonEmpty(f.Pkg), b.Pkgs},
+		{f.Ops, b.Ops},
+		{f.Decisions, b.Decisions},
+	}
+	for _, d := range dims {
+		if len(d.values) == 0 {
+			continue
+		}
+		n := sumCounts(d.counts, d.values)
+		if n == b.N {
+			continue
+		}
+		partial++
+		count = n
+	}
+
+	if partial > 1 {
+		return 0, false
+	}
+	return count, true
+}
+
+// logStore 分段日志存储
+//
+// 数据写入 access.<id>.jsonl（或二进制编码的 access.<id>.srb），每次批量
+// 写入追加一个数据块，并在同名 .idx 文件中追加一行块索引。活动分段超过
+// 大小、跨天（daily 模式）或编码切换后切换到新分段，旧分段可压缩为 .gz。
+type logStore struct {
+	dir          string
+	segmentBytes int64
+	daily        bool // 跨天时切换分段
+	binary       bool // 新分段使用二进制编码
+
+	mu        sync.RWMutex
+	segments  []*segment
+	active    *os.File
+	activeIdx *os.File
+}
+
+// openLogStore 打开分段存储，加载索引并修复未写入索引的尾部数据
+func openLogStore(dir string) (*logStore, error) {
+	s := &logStore{
+		dir:          dir,
+		segmentBytes: defaultSegmentBytes,
+	}
+
+	if err := s.migrateLegacy(); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// 压缩或转换编码过程中断时同一分段可能有多个数据文件，它们的内容
+	// 都是完整的：优先使用二进制编码，同一编码以压缩文件为准
+	type variant struct{ binary, compressed bool }
+	rank := func(v variant) int {
+		r := 0
+		if v.binary {
+			r += 2
+		}
+		if v.compressed {
+			r++
+		}
+		return r
+	}
+	found := make(map[int64][]variant)
+	for _, e := range entries {
+		id, bin, compressed, ok := parseSegmentName(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		found[id] = append(found[id], variant{bin, compressed})
+	}
+
+	for id, variants := range found {
+		best := variants[0]
+		for _, v := range variants[1:] {
+			if rank(v) > rank(best) {
+				best = v
+			}
+		}
+		if len(variants) > 1 {
+			for _, v := range variants {
+				if v != best {
+					path := s.segmentPath(id, v.binary)
+					if v.compressed {
+						path += segmentGzipExt
+					}
+					os.Remove(path)
+				}
+			}
+			// 索引可能属于被删除的文件，重新建立
+			os.Remove(s.indexPath(id))
+		}
+		seg, err := s.loadSegment(id, best.binary, best.compressed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load segment %d: %w", id, err)
+		}
+		s.segments = append(s.segments, seg)
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].id < s.segments[j].id
+	})
+
+	return s, nil
+}
+
+// migrateLegacy 将旧版单文件 access.log 转为第一个分段
+func (s *logStore) migrateLegacy() error {
+	legacy := filepath.Join(s.dir, "access.log")
+	if _, err := os.Stat(legacy); err != nil {
+		return nil
+	}
+
+	var maxID int64
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if id, _, _, ok := parseSegmentName(e.Name()); ok && id > maxID {
+			maxID = id
+		}
+	}
+
+	return os.Rename(legacy, s.segmentPath(maxID+1, false))
+}
+
+// loadSegment 加载分段索引，数据比索引长时为尾部补建索引
+func (s *logStore) loadSegment(id int64, bin, compressed bool) (*segment, error) {
+	seg := &segment{
+		id:         id,
+		path:       s.segmentPath(id, bin),
+		idxPath:    s.indexPath(id),
+		compressed: compressed,
+		binary:     bin,
+	}
+
+	if compressed {
+		seg.path += segmentGzipExt
+		return seg, s.loadCompressedSegment(seg)
+	}
+
+	// 截掉未写完的最后一行（或数据块），避免后续追加时与其拼接
+	truncate := truncatePartialLine
+	if bin {
+		truncate = truncatePartialBlock
+	}
+	size, err := truncate(seg.path)
+	if err != nil {
+		return nil, err
+	}
+	seg.size = size
+
+	var indexed int64
+	if data, err := os.ReadFile(seg.idxPath); err == nil {
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			if len(line) == 0 {
+				continue
+			}
+			var b blockIndex
+			if err := json.Unmarshal(line, &b); err != nil {
+				break
+			}
+			// 索引指向已不存在的数据时丢弃
+			if b.Off != indexed || b.Off+b.Len > seg.size {
+				break
+			}
+			seg.blocks = append(seg.blocks, &b)
+			indexed = b.Off + b.Len
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if indexed < seg.size {
+		f, err := os.Open(seg.path)
+		if err != nil {
+			return nil, err
+		}
+		_, err = f.Seek(indexed, io.SeekStart)
+		if err == nil {
+			var blocks []*blockIndex
+			blocks, err = seg.indexRange(io.LimitReader(f, seg.size-indexed), indexed)
+			seg.blocks = append(seg.blocks, blocks...)
+		}
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 以最后写入时间作为分段日期
+	seg.day = dayKey(time.Now().UnixMilli())
+	if st, err := os.Stat(seg.path); err == nil {
+		seg.day = dayKey(st.ModTime().UnixMilli())
+	}
+
+	// 重写索引，保证与数据一致
+	if err := writeIndexFile(seg.idxPath, seg.blocks); err != nil {
+		return nil, err
+	}
+	if st, err := os.Stat(seg.idxPath); err == nil {
+		seg.idxSize = st.Size()
+	}
+
+	return seg, nil
+}
+
+// loadCompressedSegment 加载压缩分段的索引，索引缺失或损坏时解压重建
+func (s *logStore) loadCompressedSegment(seg *segment) error {
+	st, err := os.Stat(seg.path)
+	if err != nil {
+		return err
+	}
+	seg.diskSize = st.Size()
+
+	if blocks, err := readIndexFile(seg.idxPath); err == nil && len(blocks) > 0 {
+		seg.blocks = blocks
+		last := blocks[len(blocks)-1]
+		seg.size = last.Off + last.Len
+	} else {
+		data, err := readGzipFile(seg.path)
+		if err != nil {
+			return err
+		}
+		seg.size = int64(len(data))
+		seg.blocks, err = seg.indexRange(bytes.NewReader(data), 0)
+		if err != nil {
+			return err
+		}
+		if err := writeIndexFile(seg.idxPath, seg.blocks); err != nil {
+			return err
+		}
+	}
+
+	if st, err := os.Stat(seg.idxPath); err == nil {
+		seg.idxSize = st.Size()
+	}
+	return nil
+}
+
+// SetEncoding 设置新分段的编码，与活动分段不同时下次写入切换到新分段
+func (s *logStore) SetEncoding(bin bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.binary = bin
+}
+
+// Configure 设置分段切换策略
+func (s *logStore) Configure(daily bool, segmentBytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.daily = daily
+	if segmentBytes > 0 {
+		s.segmentBytes = segmentBytes
+	}
+}
+
+// Append 追加一批条目，作为一个或多个数据块写入活动分段
+func (s *logStore) Append(entries []LogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for start := 0; start < len(entries); start += maxBlockEntries {
+		end := start + maxBlockEntries
+		if end > len(entries) {
+			end = len(entries)
+		}
+		if err := s.appendBlockLocked(entries[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *logStore) appendBlockLocked(entries []LogEntry) error {
+	seg, err := s.activeSegmentLocked()
+	if err != nil {
+		return err
+	}
+
+	data, b := encodeBlock(entries, seg.binary, seg.size)
+	if b.N == 0 {
+		return nil
+	}
+
+	if _, err := s.active.Write(data); err != nil {
+		return err
+	}
+	seg.size += b.Len
+
+	line, _ := json.Marshal(b)
+	line = append(line, '\n')
+	if _, err := s.activeIdx.Write(line); err != nil {
+		return err
+	}
+	seg.idxSize += int64(len(line))
+	seg.blocks = append(seg.blocks, b)
+
+	return nil
+}
+
+// writable 判断分段是否还能继续写入
+func (s *logStore) writable(seg *segment, now time.Time) bool {
+	if seg.compressed || seg.binary != s.binary || seg.size >= s.segmentBytes {
+		return false
+	}
+	if s.daily && len(seg.blocks) > 0 && seg.day != dayKey(now.UnixMilli()) {
+		return false
+	}
+	return true
+}
+
+// activeSegmentLocked 返回可写入的活动分段，必要时切换新分段（已加锁）
+func (s *logStore) activeSegmentLocked() (*segment, error) {
+	now := time.Now()
+	if n := len(s.segments); n > 0 && s.active != nil {
+		seg := s.segments[n-1]
+		if s.writable(seg, now) {
+			return seg, nil
+		}
+	}
+
+	s.closeActiveLocked()
+
+	var seg *segment
+	if n := len(s.segments); n > 0 && s.writable(s.segments[n-1], now) {
+		// 重新打开上次未写满的分段
+		seg = s.segments[n-1]
+	} else {
+		var id int64 = 1
+		if n > 0 {
+			id = s.segments[n-1].id + 1
+		}
+		seg = &segment{
+			id:      id,
+			path:    s.segmentPath(id, s.binary),
+			idxPath: s.indexPath(id),
+			day:     dayKey(now.UnixMilli()),
+			binary:  s.binary,
+		}
+		s.segments = append(s.segments, seg)
+	}
+
+	f, err := os.OpenFile(seg.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := os.OpenFile(seg.idxPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	s.active = f
+	s.activeIdx = idx
+	return seg, nil
+}
+
+func (s *logStore) closeActiveLocked() {
+	if s.active != nil {
+		s.active.Close()
+		s.active = nil
+	}
+	if s.activeIdx != nil {
+		s.activeIdx.Close()
+		s.activeIdx = nil
+	}
+}
+
+// Close 关闭活动分段
+func (s *logStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeActiveLocked()
+	return nil
+}
+
+// blockRef 查询时引用的数据块
+type blockRef struct {
+	seg   *segment
+	block *blockIndex
+}
+
+// candidatesLocked 返回可能包含匹配条目的数据块，按最晚时间降序（已加锁）
+func (s *logStore) candidatesLocked(f *LogFilter) []blockRef {
+	var refs []blockRef
+	for _, seg := range s.segments {
+		for _, b := range seg.blocks {
+			if f.mayMatch(b) {
+				refs = append(refs, blockRef{seg: seg, block: b})
+			}
+		}
+	}
+
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].block.MaxTs > refs[j].block.MaxTs
+	})
+	return refs
+}
+
+// Collect 按时间降序返回最新的 need 条匹配条目；countTotal 为 true 时同时统计匹配总数
+//
+// 数据块按最晚时间降序解码，一旦已收集的条目都比剩余块更新即停止解码，
+// 剩余块的匹配数尽量直接由索引得出。
+func (s *logStore) Collect(f *LogFilter, need int, countTotal bool) ([]LogEntry, int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	refs := s.candidatesLocked(f)
+	reader := newBlockReader()
+	defer reader.Close()
+
+	var got []LogEntry
+	total := 0
+	i := 0
+
+	for ; i < len(refs); i++ {
+		if len(got) >= need && (need == 0 || got[need-1].Ts > refs[i].block.MaxTs) {
+			break
+		}
+
+		entries, err := reader.Read(refs[i])
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, e := range entries {
+			if f.Match(&e) {
+				got = append(got, e)
+				total++
+			}
+		}
+
+		sortEntriesDesc(got)
+		if len(got) > need {
+			got = got[:need]
+		}
+	}
+
+	if countTotal {
+		for ; i < len(refs); i++ {
+			if n, ok := f.exactCount(refs[i].block); ok {
+				total += n
+				continue
+			}
+			entries, err := reader.Read(refs[i])
+			if err != nil {
+				return nil, 0, err
+			}
+			for _, e := range entries {
+				if f.Match(&e) {
+					total++
+				}
+			}
+		}
+	}
+
+	if got == nil {
+		got = []LogEntry{}
+	}
+	return got, total, nil
+}
+
+// Scan 按写入顺序遍历全部匹配条目，fn 返回 false 时停止
+func (s *logStore) Scan(f *LogFilter, fn func(*LogEntry) bool) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reader := newBlockReader()
+	defer reader.Close()
+
+	for _, seg := range s.segments {
+		for _, b := range seg.blocks {
+			if !f.mayMatch(b) {
+				continue
+			}
+			entries, err := reader.Read(blockRef{seg: seg, block: b})
+			if err != nil {
+				return err
+			}
+			for i := range entries {
+				if f.Match(&entries[i]) && !fn(&entries[i]) {
+					return nil
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CountByPkg 统计各应用的匹配条目数，只有时间条件的块直接使用索引计数
+func (s *logStore) CountByPkg(f *LogFilter) (map[string]int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reader := newBlockReader()
+	defer reader.Close()
+
+	// 除时间与包名外没有其他条件时，块内各应用的计数即为结果
+	indexOnly := len(f.Ops) == 0 && len(f.Decisions) == 0 && f.Contains == "" && f.PathPrefix == "" &&
+		f.Where == nil && f.After == nil
+
+	counts := make(map[string]int)
+	for _, seg := range s.segments {
+		for _, b := range seg.blocks {
+			if !f.mayMatch(b) {
+				continue
+			}
+			inRange := (f.From <= 0 || b.MinTs >= f.From) && (f.To <= 0 || b.MaxTs <= f.To)
+			if indexOnly && inRange {
+				for pkg, n := range b.Pkgs {
+					if f.Pkg == "" || pkg == f.Pkg {
+						counts[pkg] += n
+					}
+				}
+				continue
+			}
+
+			entries, err := reader.Read(blockRef{seg: seg, block: b})
+			if err != nil {
+				return nil, err
+			}
+			for i := range entries {
+				if f.Match(&entries[i]) {
+					counts[entries[i].Pkg]++
+				}
+			}
+		}
+	}
+	return counts, nil
+}
+
+// RemoveAll 删除全部分段
+func (s *logStore) RemoveAll() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeActiveLocked()
+	for _, seg := range s.segments {
+		if err := removeSegmentFiles(seg); err != nil {
+			return err
+		}
+	}
+	s.segments = nil
+	return nil
+}
+
+// RemoveWhere 删除匹配 f 的条目，只重写包含匹配条目的分段
+func (s *logStore) RemoveWhere(f *LogFilter) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeActiveLocked()
+
+	removed := 0
+	for _, seg := range s.segments {
+		affected := false
+		for _, b := range seg.blocks {
+			if f.mayMatch(b) {
+				affected = true
+				break
+			}
+		}
+		if !affected {
+			continue
+		}
+
+		n, err := s.rewriteSegmentLocked(seg, func(e *LogEntry) bool { return !f.Match(e) })
+		if err != nil {
+			return removed, err
+		}
+		removed += n
+	}
+
+	s.dropEmptyLocked()
+	return removed, nil
+}
+
+// UpdateWhere 对匹配 f 的条目调用 update 原地修改，只重写有条目被修改的分段，
+// 返回修改的条目数
+func (s *logStore) UpdateWhere(f *LogFilter, update func(*LogEntry) bool) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeActiveLocked()
+
+	changed := 0
+	for _, seg := range s.segments {
+		affected := false
+		for _, b := range seg.blocks {
+			if f.mayMatch(b) {
+				affected = true
+				break
+			}
+		}
+		if !affected {
+			continue
+		}
+
+		_, n, err := s.editSegmentLocked(seg, func(e *LogEntry) (bool, bool) {
+			return true, f.Match(e) && update(e)
+		})
+		if err != nil {
+			return changed, err
+		}
+		changed += n
+	}
+	return changed, nil
+}
+
+// dropEmptyLocked 删除重写后已为空的非活动分段（已加锁）
+func (s *logStore) dropEmptyLocked() {
+	kept := s.segments[:0]
+	for i, seg := range s.segments {
+		if len(seg.blocks) == 0 && i < len(s.segments)-1 {
+			removeSegmentFiles(seg)
+			continue
+		}
+		kept = append(kept, seg)
+	}
+	s.segments = kept
+}
+
+// rewriteSegmentLocked 按 keep 重写分段并重建索引，返回删除的条目数（已加锁）
+func (s *logStore) rewriteSegmentLocked(seg *segment, keep func(*LogEntry) bool) (int, error) {
+	removed, _, err := s.editSegmentLocked(seg, func(e *LogEntry) (bool, bool) {
+		return keep(e), false
+	})
+	return removed, err
+}
+
+// editSegmentLocked 逐条调用 edit（可原地修改条目），返回是否保留及是否修改；
+// 有条目被删除或修改时重写分段，返回删除与修改的条目数（已加锁）
+func (s *logStore) editSegmentLocked(seg *segment, edit func(*LogEntry) (bool, bool)) (int, int, error) {
+	reader := newBlockReader()
+	defer reader.Close()
+
+	var kept []LogEntry
+	removed, changed := 0, 0
+	for _, b := range seg.blocks {
+		entries, err := reader.Read(blockRef{seg: seg, block: b})
+		if err != nil {
+			return 0, 0, err
+		}
+		for _, e := range entries {
+			keep, modified := edit(&e)
+			if !keep {
+				removed++
+				continue
+			}
+			if modified {
+				changed++
+			}
+			kept = append(kept, e)
+		}
+	}
+	reader.Close()
+
+	if removed == 0 && changed == 0 {
+		return 0, 0, nil
+	}
+
+	// 压缩分段重写后恢复为未压缩分段，之后由轮转重新压缩
+	if err := s.replaceSegmentLocked(seg, kept, seg.binary); err != nil {
+		return 0, 0, err
+	}
+	return removed, changed, nil
+}
+
+// replaceSegmentLocked 以指定编码重写分段数据并重建索引（已加锁）
+func (s *logStore) replaceSegmentLocked(seg *segment, entries []LogEntry, bin bool) error {
+	plainPath := s.segmentPath(seg.id, bin)
+	tmpPath := plainPath + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	var blocks []*blockIndex
+	var off int64
+	for start := 0; start < len(entries); start += maxBlockEntries {
+		end := start + maxBlockEntries
+		if end > len(entries) {
+			end = len(entries)
+		}
+		data, b := encodeBlock(entries[start:end], bin, off)
+		w.Write(data)
+		off += b.Len
+		blocks = append(blocks, b)
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	f.Close()
+
+	// 旧索引与新数据的偏移不一致，中断时由启动加载重建
+	os.Remove(seg.idxPath)
+	if err := os.Rename(tmpPath, plainPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if seg.path != plainPath {
+		os.Remove(seg.path)
+		seg.path = plainPath
+		seg.compressed = false
+		seg.diskSize = 0
+		seg.binary = bin
+	}
+	if err := writeIndexFile(seg.idxPath, blocks); err != nil {
+		return err
+	}
+
+	seg.blocks = blocks
+	seg.size = off
+	if st, err := os.Stat(seg.idxPath); err == nil {
+		seg.idxSize = st.Size()
+	}
+	return nil
+}
+
+// Convert 将全部分段转换为指定编码（压缩分段转换后重新压缩），
+// 返回转换的分段数以及这些分段转换前后占用的字节数
+func (s *logStore) Convert(bin bool) (int, int64, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closeActiveLocked()
+
+	converted := 0
+	var before, after int64
+	for _, seg := range s.segments {
+		if seg.binary == bin || len(seg.blocks) == 0 {
+			continue
+		}
+
+		reader := newBlockReader()
+		var entries []LogEntry
+		for _, b := range seg.blocks {
+			block, err := reader.Read(blockRef{seg: seg, block: b})
+			if err != nil {
+				reader.Close()
+				return converted, before, after, err
+			}
+			entries = append(entries, block...)
+		}
+		reader.Close()
+
+		size := seg.bytesOnDisk()
+		compressed := seg.compressed
+		if err := s.replaceSegmentLocked(seg, entries, bin); err != nil {
+			return converted, before, after, err
+		}
+		if compressed {
+			if err := compressSegment(seg); err != nil {
+				return converted, before, after, err
+			}
+		}
+		before += size
+		after += seg.bytesOnDisk()
+		converted++
+	}
+	return converted, before, after, nil
+}
+
+// RemoveOldest 删除最旧的分段（不会删除唯一的分段），返回释放的字节数
+func (s *logStore) RemoveOldest() (int64, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.segments) <= 1 {
+		return 0, false, nil
+	}
+
+	seg := s.segments[0]
+	if err := removeSegmentFiles(seg); err != nil {
+		return 0, false, err
+	}
+	s.segments = s.segments[1:]
+	return seg.bytesOnDisk(), true, nil
+}
+
+// CompressBefore 压缩最晚条目早于 before 的非活动分段，返回压缩的分段数
+func (s *logStore) CompressBefore(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limit := before.UnixMilli()
+	compressed := 0
+	// 最后一个分段可能仍在写入，不压缩
+	for i := 0; i < len(s.segments)-1; i++ {
+		seg := s.segments[i]
+		if seg.compressed || len(seg.blocks) == 0 || seg.maxTs() >= limit {
+			continue
+		}
+		if err := compressSegment(seg); err != nil {
+			return compressed, err
+		}
+		compressed++
+	}
+	return compressed, nil
+}
+
+// Sync 将活动分段及其索引落盘
+func (s *logStore) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active != nil {
+		if err := s.active.Sync(); err != nil {
+			return err
+		}
+	}
+	if s.activeIdx != nil {
+		return s.activeIdx.Sync()
+	}
+	return nil
+}
+
+// LastSeq 返回已写入条目的最大序号
+func (s *logStore) LastSeq() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var seq int64
+	for _, seg := range s.segments {
+		for _, b := range seg.blocks {
+			if b.MaxSeq > seq {
+				seq = b.MaxSeq
+			}
+		}
+	}
+	return seq
+}
+
+// Last 返回最后写入的条目，存储为空时返回 nil
+func (s *logStore) Last() (*LogEntry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reader := newBlockReader()
+	defer reader.Close()
+
+	for i := len(s.segments) - 1; i >= 0; i-- {
+		seg := s.segments[i]
+		for j := len(seg.blocks) - 1; j >= 0; j-- {
+			entries, err := reader.Read(blockRef{seg: seg, block: seg.blocks[j]})
+			if err != nil {
+				return nil, err
+			}
+			if len(entries) > 0 {
+				return &entries[len(entries)-1], nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// TotalSize 返回全部分段（含索引）占用的字节数
+func (s *logStore) TotalSize() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.bytesOnDisk()
+	}
+	return total
+}
+
+// storeStats 分段存储统计
+type storeStats struct {
+	Segments   int
+	Compressed int
+	Binary     int
+	Entries    int
+	Active     string
+	Oldest     int64
+	Newest     int64
+	Pkgs       map[string]*PkgUsage
+}
+
+// Stats 汇总索引中的统计信息
+func (s *logStore) Stats() storeStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	st := storeStats{
+		Segments: len(s.segments),
+		Pkgs:     s.usageLocked(),
+	}
+	for i, seg := range s.segments {
+		if seg.binary {
+			st.Binary++
+		}
+		if seg.compressed {
+			st.Compressed++
+		} else if i == len(s.segments)-1 {
+			st.Active = seg.name()
+		}
+		for _, b := range seg.blocks {
+			st.Entries += b.N
+			if st.Oldest == 0 || b.MinTs < st.Oldest {
+				st.Oldest = b.MinTs
+			}
+			if b.MaxTs > st.Newest {
+				st.Newest = b.MaxTs
+			}
+		}
+	}
+	return st
+}
+
+func (s *logStore) segmentPath(id int64, bin bool) string {
+	ext := segmentDataExt
+	if bin {
+		ext = segmentBinaryExt
+	}
+	return filepath.Join(s.dir, fmt.Sprintf("%s%06d%s", segmentPrefix, id, ext))
+}
+
+func (s *logStore) indexPath(id int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%06d%s", segmentPrefix, id, segmentIndexExt))
+}
+
+// blockReader 在一次查询中复用打开的分段文件与解压后的数据
+type blockReader struct {
+	files    map[string]*os.File
+	inflated map[string][]byte
+}
+
+func newBlockReader() *blockReader {
+	return &blockReader{
+		files:    make(map[string]*os.File),
+		inflated: make(map[string][]byte),
+	}
+}
+
+// Read 读取并解码一个数据块，跳过损坏的行
+func (r *blockReader) Read(ref blockRef) ([]LogEntry, error) {
+	buf, err := r.readRaw(ref)
+	if err != nil || buf == nil {
+		return nil, err
+	}
+
+	entries := decodeBlock(buf, ref.seg.binary, ref.block.N)
+	for i := range entries {
+		entries[i].pos = ref.seg.id<<32 + ref.block.Off + int64(i)
+	}
+	return entries, nil
+}
+
+// readRaw 读取数据块的原始字节，压缩分段整体解压一次后复用
+func (r *blockReader) readRaw(ref blockRef) ([]byte, error) {
+	end := ref.block.Off + ref.block.Len
+
+	if ref.seg.compressed {
+		data, ok := r.inflated[ref.seg.path]
+		if !ok {
+			var err error
+			data, err = readGzipFile(ref.seg.path)
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil, nil
+				}
+				return nil, err
+			}
+			r.inflated[ref.seg.path] = data
+		}
+		if end > int64(len(data)) {
+			return nil, fmt.Errorf("block beyond end of %s", ref.seg.name())
+		}
+		return data[ref.block.Off:end], nil
+	}
+
+	f, ok := r.files[ref.seg.path]
+	if !ok {
+		var err error
+		f, err = os.Open(ref.seg.path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		r.files[ref.seg.path] = f
+	}
+
+	buf := make([]byte, ref.block.Len)
+	if _, err := f.ReadAt(buf, ref.block.Off); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Close 关闭所有打开的文件
+func (r *blockReader) Close() {
+	for path, f := range r.files {
+		f.Close()
+		delete(r.files, path)
+	}
+	for path := range r.inflated {
+		delete(r.inflated, path)
+	}
+}
+
+func newBlockIndex(off int64) *blockIndex {
+	return &blockIndex{
+		Off:       off,
+		Pkgs:      make(map[string]int),
+		Ops:       make(map[string]int),
+		Decisions: make(map[string]int),
+		PkgBytes:  make(map[string]int64),
+	}
+}
+
+// add 将条目计入块索引，size 为条目编码后的字节数
+func (b *blockIndex) add(e *LogEntry, size int64) {
+	if b.N == 0 || e.Ts < b.MinTs {
+		b.MinTs = e.Ts
+	}
+	if e.Ts > b.MaxTs {
+		b.MaxTs = e.Ts
+	}
+	if e.Seq > b.MaxSeq {
+		b.MaxSeq = e.Seq
+	}
+	b.N++
+	b.Pkgs[e.Pkg]++
+	b.Ops[e.Op]++
+	b.Decisions[e.Decision]++
+	b.PkgBytes[e.Pkg] += size
+}
+
+// pkgBytes 返回块中某个包占用的字节数，旧版索引没有记录时按条目数估算
+func (b *blockIndex) pkgBytes(pkg string) int64 {
+	if b.PkgBytes != nil {
+		return b.PkgBytes[pkg]
+	}
+	if b.N == 0 {
+		return 0
+	}
+	return b.Len * int64(b.Pkgs[pkg]) / int64(b.N)
+}
+
+// indexRange 按分段编码扫描从偏移 from 开始的数据并生成块索引
+func (seg *segment) indexRange(r io.Reader, from int64) ([]*blockIndex, error) {
+	if seg.binary {
+		return indexBinaryRange(r, from)
+	}
+	return indexJSONRange(r, from)
+}
+
+// indexJSONRange 扫描从偏移 from 开始的 JSONL 数据，每 maxBlockEntries 行生成一个块索引
+func indexJSONRange(r io.Reader, from int64) ([]*blockIndex, error) {
+	var blocks []*blockIndex
+	b := newBlockIndex(from)
+	off := from
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			off += int64(len(line))
+			b.Len += int64(len(line))
+			var entry LogEntry
+			if json.Unmarshal(bytes.TrimSpace(line), &entry) == nil {
+				b.add(&entry, int64(len(line)))
+			}
+			if b.N >= maxBlockEntries {
+				blocks = append(blocks, b)
+				b = newBlockIndex(off)
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	if b.Len > 0 {
+		blocks = append(blocks, b)
+	}
+
+	return blocks, nil
+}
+
+// truncatePartialLine 截掉文件末尾未以换行结束的内容，返回截断后的大小
+func truncatePartialLine(path string) (int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0644)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := st.Size()
+
+	// 从尾部向前查找最后一个换行
+	const chunk = 4096
+	end := size
+	for end > 0 {
+		start := end - chunk
+		if start < 0 {
+			start = 0
+		}
+		buf := make([]byte, end-start)
+		if _, err := f.ReadAt(buf, start); err != nil && err != io.EOF {
+			return 0, err
+		}
+		if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+			newSize := start + int64(i) + 1
+			if newSize != size {
+				return newSize, f.Truncate(newSize)
+			}
+			return size, nil
+		}
+		end = start
+	}
+
+	if size > 0 {
+		return 0, f.Truncate(0)
+	}
+	return 0, nil
+}
+
+// readIndexFile 读取索引文件，遇到损坏的行时报错
+func readIndexFile(path string) ([]*blockIndex, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var blocks []*blockIndex
+	var off int64
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		var b blockIndex
+		if err := json.Unmarshal(line, &b); err != nil {
+			return nil, err
+		}
+		if b.Off != off {
+			return nil, fmt.Errorf("index gap at offset %d", off)
+		}
+		off = b.Off + b.Len
+		blocks = append(blocks, &b)
+	}
+	return blocks, nil
+}
+
+func writeIndexFile(path string, blocks []*blockIndex) error {
+	var buf bytes.Buffer
+	for _, b := range blocks {
+		data, _ := json.Marshal(b)
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func removeSegmentFiles(seg *segment) error {
+	if err := os.Remove(seg.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(seg.idxPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// compressSegment 将分段压缩为 .jsonl.gz（或 .srb.gz）并删除原文件
+func compressSegment(seg *segment) error {
+	src, err := os.Open(seg.path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	gzPath := seg.path + segmentGzipExt
+	tmpPath := gzPath + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, gzPath); err != nil {
+		return err
+	}
+	os.Remove(seg.path)
+
+	seg.path = gzPath
+	seg.compressed = true
+	if st, err := os.Stat(gzPath); err == nil {
+		seg.diskSize = st.Size()
+	}
+	return nil
+}
+
+func readGzipFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+
+	return io.ReadAll(zr)
+}
+
+// parseSegmentName 解析 access.<id>.jsonl、access.<id>.srb 及其 .gz 形式的文件名，
+// 返回分段 id、是否二进制编码、是否压缩
+func parseSegmentName(name string) (int64, bool, bool, bool) {
+	compressed := strings.HasSuffix(name, segmentGzipExt)
+	name = strings.TrimSuffix(name, segmentGzipExt)
+
+	ext := segmentDataExt
+	if strings.HasSuffix(name, segmentBinaryExt) {
+		ext = segmentBinaryExt
+	}
+	if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, ext) {
+		return 0, false, false, false
+	}
+	id, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), ext), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, false, false, false
+	}
+	return id, ext == segmentBinaryExt, compressed, true
+}
+
+// dayKey 返回时间戳对应的本地日期
+func dayKey(ms int64) string {
+	return time.UnixMilli(ms).Format("2006-01-02")
+}
+
+// sortEntriesDesc 按 (ts, seq) 降序排序，没有 seq 的旧条目按存储位置降序
+func sortEntriesDesc(entries []LogEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Ts != entries[j].Ts {
+			return entries[i].Ts > entries[j].Ts
+		}
+		if entries[i].Seq != entries[j].Seq {
+			return entries[i].Seq > entries[j].Seq
+		}
+		return entries[i].pos > entries[j].pos
+	})
+}
+
+func sumCounts(counts map[string]int, keys []string) int {
+	n := 0
+	for _, k := range keys {
+		n += counts[k]
+	}
+	return n
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
@@ -8,6 +8,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 )
 
 const (
@@ -21,6 +22,12 @@ type Daemon struct {
 	logDir        string
 	socketPath    string
 	server        *Server
+	scheduler     *Scheduler
+	procResolver  *ProcResolver
+	attributor    *Attributor
+	registry      *ProcessRegistry
+	rotator       *LogRotator
+	flusher       *LogFlusher
 	logger        *Logger
 	ctx           context.Context
 	cancel        context.CancelFunc
@@ -40,39 +47,58 @@ func NewDaemon() (*Daemon, error) {
 		configDir = filepath.Join(modDir, "config")
 	}
 
-	logDir := os.Getenv("SR_LOGDIR")
-	if logDir == "" {
-		logDir = filepath.Join(modDir, "logs")
-	}
+	logDir := logDirFromEnv()
 
 	socketPath := os.Getenv("SR_SOCKET")
 	if socketPath == "" {
 		socketPath = filepath.Join(modDir, "run", "ipc.sock")
 	}
 
+	procRoot := os.Getenv("SR_PROC_ROOT")
+	if procRoot == "" {
+		procRoot = "/proc"
+	}
+
+	packagesList := os.Getenv("SR_PACKAGES_LIST")
+	if packagesList == "" {
+		packagesList = "/data/system/packages.list"
+	}
+
 	// 创建日志目录
 	if err := os.MkdirAll(logDir, 0755); err != nil {
+		cancel()
 		return nil, fmt.Errorf("failed to create log dir: %w", err)
 	}
 
 	// 创建运行目录
 	runDir := filepath.Dir(socketPath)
 	if err := os.MkdirAll(runDir, 0755); err != nil {
+		cancel()
 		return nil, fmt.Errorf("failed to create run dir: %w", err)
 	}
 
 	// 初始化日志系统
 	logger, err := NewLogger(logDir)
 	if err != nil {
+		cancel()
 		return nil, fmt.Errorf("failed to init logger: %w", err)
 	}
 
+	// 每周时间段按设备时区计算
+	if loc, err := loadDeviceLocation(); err != nil {
+		logger.Warnf("scheduler", "Failed to load device time zone: %v, using %s", err, scheduleLoc)
+	} else {
+		scheduleLoc = loc
+		logger.Infof("scheduler", "Schedule time zone: %s", loc)
+	}
+
 	// 初始化配置管理器
 	configManager, err := NewConfigManager(configDir)
 	if err != nil {
-		logger.Printf("Warning: failed to init config manager: %v, using default", err)
+		logger.Warnf("config", "Failed to init config manager: %v, using default", err)
 		configManager, err = NewConfigManager(configDir)
 		if err != nil {
+			cancel()
 			return nil, fmt.Errorf("failed to create config manager: %w", err)
 		}
 	}
@@ -82,35 +108,75 @@ func NewDaemon() (*Daemon, error) {
 		configDir:     configDir,
 		logDir:        logDir,
 		socketPath:    socketPath,
+		procResolver:  NewProcResolver(procRoot, packagesList),
 		logger:        logger,
 		ctx:           ctx,
 		cancel:        cancel,
 	}
 
+	// 按 monitorEnabled / logLevel 过滤访问日志
+	logger.WatchConfig(configManager)
+
+	// 配置版本变化（包括生效时间切换与临时覆盖到期）后重写钩子读取的生效配置
+	syncEffective := func() {
+		if err := configManager.SyncEffectiveConfigs(time.Now()); err != nil {
+			logger.Errorf("config", "Failed to write effective app configs: %v", err)
+		}
+	}
+	syncEffective()
+	configManager.Watch(func(int) { syncEffective() })
+
+	// 创建进程归属引擎
+	d.attributor = NewAttributor(d.procResolver, configManager)
+
+	// 创建运行时进程注册表
+	d.registry = NewProcessRegistry(procRoot, configManager, logger)
+
 	// 创建服务器
 	d.server = NewServer(socketPath, d)
 
+	// 创建规则生效时间调度器
+	d.scheduler = NewScheduler(configManager, logger)
+
+	// 创建日志轮转器
+	d.rotator = NewLogRotator(configManager, logger)
+
+	// 创建日志后台刷新器
+	d.flusher = NewLogFlusher(configManager, logger)
+
 	return d, nil
 }
 
 func (d *Daemon) Run() error {
-	d.logger.Printf("StorageRedirect Daemon v%s starting...", Version)
-	d.logger.Printf("Config directory: %s", d.configDir)
+	d.logger.Infof("daemon", "StorageRedirect Daemon v%s starting...", Version)
+	d.logger.Infof("daemon", "Config directory: %s", d.configDir)
 
 	// 启动服务器
 	go func() {
 		if err := d.server.Start(); err != nil {
-			d.logger.Printf("Server error: %v", err)
+			d.logger.Errorf("server", "Server error: %v", err)
 		}
 	}()
 
+	// 启动规则生效时间调度器
+	d.scheduler.Start()
+
+	// 启动进程注册表清理
+	d.registry.Start()
+
+	// 启动日志轮转
+	d.rotator.Start()
+
+	// 启动日志后台刷新
+	d.flusher.Start()
+
 	// 等待信号
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
 	select {
 	case sig := <-sigCh:
-		d.logger.Printf("Received signal: %v", sig)
+		d.logger.Infof("daemon", "Received signal: %v", sig)
 	case <-d.ctx.Done():
 	}
 
@@ -118,9 +184,25 @@ func (d *Daemon) Run() error {
 }
 
 func (d *Daemon) Shutdown() error {
-	d.logger.Printf("Shutting down...")
+	d.logger.Infof("daemon", "Shutting down...")
 	d.cancel()
 
+	if d.scheduler != nil {
+		d.scheduler.Stop()
+	}
+
+	if d.registry != nil {
+		d.registry.Stop()
+	}
+
+	if d.rotator != nil {
+		d.rotator.Stop()
+	}
+
+	if d.flusher != nil {
+		d.flusher.Stop()
+	}
+
 	if d.server != nil {
 		d.server.Stop()
 	}
@@ -132,9 +214,23 @@ func (d *Daemon) Shutdown() error {
 	return nil
 }
 
+// logDirFromEnv 返回访问日志与守护进程日志所在目录
+func logDirFromEnv() string {
+	if dir := os.Getenv("SR_LOGDIR"); dir != "" {
+		return dir
+	}
+	modDir := os.Getenv("SR_MODDIR")
+	if modDir == "" {
+		modDir = "/data/adb/modules/StorageRedirect"
+	}
+	return filepath.Join(modDir, "logs")
+}
+
 func main() {
 	daemon, err := NewDaemon()
 	if err != nil {
+		// service.sh 丢弃了 stderr，启动失败需要记录到 daemon.log
+		reportStartupFailure(err)
 		log.Fatalf("Failed to create daemon: %v", err)
 	}
 
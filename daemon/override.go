@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// 临时覆盖类型
+const (
+	OverrideSuspend = "suspend"  // 暂停应用的全部规则
+	OverrideReplace = "override" // 使用临时配置替代已保存的配置
+)
+
+// AppOverride 叠加在已保存配置之上的临时配置，到期自动失效
+type AppOverride struct {
+	Kind      string     `json:"kind"`
+	App       *AppConfig `json:"app,omitempty"`
+	CreatedAt int64      `json:"createdAt"`
+	ExpiresAt int64      `json:"expiresAt"`
+}
+
+// expired 判断在指定时间是否已过期
+func (o *AppOverride) expired(now time.Time) bool {
+	return now.UnixMilli() >= o.ExpiresAt
+}
+
+// loadOverridesLocked 加载临时覆盖配置并丢弃已过期的项（已加锁）
+func (cm *ConfigManager) loadOverridesLocked() error {
+	cm.overrides = make(map[string]*AppOverride)
+
+	data, err := os.ReadFile(cm.overridesPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var overrides map[string]*AppOverride
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return fmt.Errorf("invalid overrides: %w", err)
+	}
+
+	now := time.Now()
+	for pkg, o := range overrides {
+		if o == nil || o.expired(now) || !isValidPackageName(pkg) {
+			continue
+		}
+		cm.overrides[pkg] = o
+	}
+
+	return nil
+}
+
+// saveOverridesLocked 保存临时覆盖配置到文件（已加锁）
+func (cm *ConfigManager) saveOverridesLocked() error {
+	data, err := json.MarshalIndent(cm.overrides, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := cm.overridesPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, cm.overridesPath)
+}
+
+// SuspendApp 在指定时长内暂停应用的全部规则
+func (cm *ConfigManager) SuspendApp(pkg string, duration time.Duration) (*AppOverride, error) {
+	if duration <= 0 {
+		return nil, fmt.Errorf("durationMs must be positive")
+	}
+	return cm.setOverride(pkg, &AppOverride{Kind: OverrideSuspend}, duration)
+}
+
+// OverrideApp 在指定时长内使用临时配置替代已保存的配置
+func (cm *ConfigManager) OverrideApp(pkg string, app *AppConfig, ttl time.Duration) (*AppOverride, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("ttlMs must be positive")
+	}
+	if err := validateAppConfig(app); err != nil {
+		return nil, err
+	}
+	return cm.setOverride(pkg, &AppOverride{Kind: OverrideReplace, App: app}, ttl)
+}
+
+func (cm *ConfigManager) setOverride(pkg string, o *AppOverride, ttl time.Duration) (*AppOverride, error) {
+	if !isValidPackageName(pkg) {
+		return nil, fmt.Errorf("invalid package name: %q", pkg)
+	}
+
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	now := time.Now()
+	o.CreatedAt = now.UnixMilli()
+	o.ExpiresAt = now.Add(ttl).UnixMilli()
+
+	prev, hadPrev := cm.overrides[pkg]
+	cm.overrides[pkg] = o
+	if err := cm.saveOverridesLocked(); err != nil {
+		if hadPrev {
+			cm.overrides[pkg] = prev
+		} else {
+			delete(cm.overrides, pkg)
+		}
+		return nil, err
+	}
+	cm.bumpVersionLocked()
+
+	result := *o
+	return &result, nil
+}
+
+// RestoreApp 立即移除应用的临时覆盖，返回是否存在覆盖
+func (cm *ConfigManager) RestoreApp(pkg string) (bool, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	prev, ok := cm.overrides[pkg]
+	if !ok {
+		return false, nil
+	}
+
+	delete(cm.overrides, pkg)
+	if err := cm.saveOverridesLocked(); err != nil {
+		cm.overrides[pkg] = prev
+		return true, err
+	}
+	cm.bumpVersionLocked()
+	return true, nil
+}
+
+// GetOverride 获取应用当前有效的临时覆盖
+func (cm *ConfigManager) GetOverride(pkg string) (*AppOverride, bool) {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	o, ok := cm.overrides[pkg]
+	if !ok || o.expired(time.Now()) {
+		return nil, false
+	}
+
+	// 深拷贝
+	data, _ := json.Marshal(o)
+	var result AppOverride
+	json.Unmarshal(data, &result)
+	return &result, true
+}
+
+// ListOverrides 列出所有有效的临时覆盖
+func (cm *ConfigManager) ListOverrides() []map[string]interface{} {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	now := time.Now()
+	result := make([]map[string]interface{}, 0, len(cm.overrides))
+	for pkg, o := range cm.overrides {
+		if o.expired(now) {
+			continue
+		}
+
+		item := map[string]interface{}{
+			"pkg":         pkg,
+			"kind":        o.Kind,
+			"createdAt":   o.CreatedAt,
+			"expiresAt":   o.ExpiresAt,
+			"remainingMs": o.ExpiresAt - now.UnixMilli(),
+		}
+		if o.App != nil {
+			item["app"] = o.App
+		}
+		result = append(result, item)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i]["expiresAt"].(int64) < result[j]["expiresAt"].(int64)
+	})
+
+	return result
+}
+
+// PruneOverrides 移除已过期的临时覆盖，有变化时递增配置版本
+func (cm *ConfigManager) PruneOverrides(now time.Time) (int, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	expired := make(map[string]*AppOverride)
+	for pkg, o := range cm.overrides {
+		if o.expired(now) {
+			expired[pkg] = o
+			delete(cm.overrides, pkg)
+		}
+	}
+
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	if err := cm.saveOverridesLocked(); err != nil {
+		for pkg, o := range expired {
+			cm.overrides[pkg] = o
+		}
+		return 0, err
+	}
+	cm.bumpVersionLocked()
+	return len(expired), nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCred 连接对端进程的凭据，由内核通过 SO_PEERCRED 提供，客户端无法伪造
+type peerCred struct {
+	Pid   int
+	Uid   int
+	Gid   int
+	Known bool // 读取失败（非 unix socket）时为 false
+}
+
+// connPeerCred 读取 unix socket 对端的凭据
+func connPeerCred(conn net.Conn) peerCred {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return peerCred{}
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return peerCred{}
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil || credErr != nil {
+		return peerCred{}
+	}
+	return peerCred{Pid: int(cred.Pid), Uid: int(cred.Uid), Gid: int(cred.Gid), Known: true}
+}
+
+// isRoot 对端是否为 root 进程
+func (p peerCred) isRoot() bool {
+	return p.Known && p.Uid == 0
+}
+
+// actsFor 对端是否可以代表 pid 进行操作：root 可代为操作（调试工具），
+// 其他进程只能操作自己
+func (p peerCred) actsFor(pid int) bool {
+	return p.isRoot() || (p.Known && p.Pid == pid)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Android uid 划分（见 android.os.Process）
+const (
+	perUserRange             = 100000
+	firstApplicationUid      = 10000
+	lastApplicationUid       = 19999
+	firstAppZygoteIsolatedId = 90000
+	lastAppZygoteIsolatedId  = 98999
+	firstIsolatedUid         = 99000
+	lastIsolatedUid          = 99999
+)
+
+// 归属理由枚举（PRD §4.2 resolutionReason）
+const (
+	ReasonByUidPrimary = "BY_UID_PRIMARY" // uid 唯一对应一个包
+	ReasonByUidShared  = "BY_UID_SHARED"  // sharedUserId，多个包共用 uid
+	ReasonByProcName   = "BY_PROC_NAME"   // 通过进程名前缀匹配包名
+	ReasonByAppZygote  = "BY_APP_ZYGOTE"  // 由 app zygote 派生，归属到宿主包
+	ReasonByParent     = "BY_PARENT"      // 通过父进程归属
+	ReasonSystemUid    = "SYSTEM_UID"     // 系统 uid，不属于任何应用
+	ReasonUnknown      = "UNKNOWN"
+)
+
+// ProcessInfo 进程身份信息
+type ProcessInfo struct {
+	Pid              int    `json:"pid"`
+	PPid             int    `json:"ppid"`
+	Uid              int    `json:"uid"`
+	UserId           int    `json:"userId"`
+	AppId            int    `json:"appId"`
+	Proc             string `json:"proc"`
+	SeContext        string `json:"seContext,omitempty"`
+	ParentProc       string `json:"parentProc,omitempty"`
+	ParentUid        int    `json:"parentUid"`
+	IsIsolated       bool   `json:"isIsolated"`
+	IsAppZygote      bool   `json:"isAppZygote"`
+	IsAppZygoteChild bool   `json:"isAppZygoteChild"`
+	IsChildProcess   bool   `json:"isChildProcess"`
+	PackageName      string `json:"packageName"`
+	ResolutionReason string `json:"resolutionReason"`
+}
+
+// ProcResolver 根据 /proc 与 packages.list 解析进程身份
+//
+// procRoot 与 packagesList 可指向伪造的目录结构，便于在非 Android 环境测试。
+type ProcResolver struct {
+	procRoot     string
+	packagesList string
+
+	mu        sync.Mutex
+	byAppId   map[int][]string
+	listMtime time.Time
+}
+
+// NewProcResolver 创建进程身份解析器
+func NewProcResolver(procRoot, packagesList string) *ProcResolver {
+	return &ProcResolver{
+		procRoot:     procRoot,
+		packagesList: packagesList,
+		byAppId:      make(map[int][]string),
+	}
+}
+
+// Resolve 解析指定 pid 的进程身份
+func (r *ProcResolver) Resolve(pid int) (*ProcessInfo, error) {
+	info, err := r.readProcess(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	// 父进程信息（读取失败不影响结果）
+	var parent *ProcessInfo
+	if info.PPid > 0 {
+		if p, err := r.readProcess(info.PPid); err == nil {
+			parent = p
+			info.ParentProc = p.Proc
+			info.ParentUid = p.Uid
+		}
+	}
+
+	if parent != nil {
+		info.IsAppZygoteChild = parent.IsAppZygote
+		info.IsChildProcess = !parent.IsAppZygote && !isZygoteName(parent.Proc) &&
+			isApplicationAppId(parent.AppId)
+	}
+
+	r.resolvePackage(info, parent)
+	return info, nil
+}
+
+// resolvePackage 确定进程归属的包名与归属理由
+func (r *ProcResolver) resolvePackage(info *ProcessInfo, parent *ProcessInfo) {
+	info.ResolutionReason = ReasonUnknown
+
+	switch {
+	case info.IsIsolated || isAppZygoteIsolatedAppId(info.AppId):
+		// isolated 进程没有自己的包，尝试通过 app zygote 父进程或进程名归属
+		if parent != nil && parent.IsAppZygote {
+			if pkg, _ := r.packageForUid(parent.AppId, parent.Proc); pkg != "" {
+				info.PackageName = pkg
+				info.ResolutionReason = ReasonByAppZygote
+				return
+			}
+		}
+		if pkg := r.packageForProcName(info.Proc); pkg != "" {
+			info.PackageName = pkg
+			info.ResolutionReason = ReasonByProcName
+		}
+
+	case isApplicationAppId(info.AppId):
+		if pkg, shared := r.packageForUid(info.AppId, info.Proc); pkg != "" {
+			info.PackageName = pkg
+			info.ResolutionReason = ReasonByUidPrimary
+			if shared {
+				info.ResolutionReason = ReasonByUidShared
+			}
+			return
+		}
+		if pkg := r.packageForProcName(info.Proc); pkg != "" {
+			info.PackageName = pkg
+			info.ResolutionReason = ReasonByProcName
+			return
+		}
+		// 应用 fork 出的子进程可能改过进程名，退回到父进程
+		if info.IsChildProcess {
+			if pkg, _ := r.packageForUid(parent.AppId, parent.Proc); pkg != "" {
+				info.PackageName = pkg
+				info.ResolutionReason = ReasonByParent
+			}
+		}
+
+	default:
+		info.ResolutionReason = ReasonSystemUid
+	}
+}
+
+// readProcess 读取单个进程的 status、cmdline 与 SELinux 上下文
+func (r *ProcResolver) readProcess(pid int) (*ProcessInfo, error) {
+	dir := filepath.Join(r.procRoot, strconv.Itoa(pid))
+
+	status, err := os.ReadFile(filepath.Join(dir, "status"))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &ProcessInfo{Pid: pid, Uid: -1}
+	var name string
+	scanner := bufio.NewScanner(bytes.NewReader(status))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		switch key {
+		case "Name":
+			name = strings.TrimSpace(value)
+		case "PPid":
+			if len(fields) > 0 {
+				info.PPid, _ = strconv.Atoi(fields[0])
+			}
+		case "Uid":
+			// 实际 uid 为第一列
+			if len(fields) > 0 {
+				info.Uid, _ = strconv.Atoi(fields[0])
+			}
+		}
+	}
+	if info.Uid < 0 {
+		return nil, fmt.Errorf("no Uid in %s/status", dir)
+	}
+
+	// cmdline 以 NUL 分隔，argv[0] 即 Android 进程名；内核线程为空时回退到 Name
+	info.Proc = name
+	if cmdline, err := os.ReadFile(filepath.Join(dir, "cmdline")); err == nil {
+		if argv0, _, _ := bytes.Cut(cmdline, []byte{0}); len(argv0) > 0 {
+			info.Proc = string(argv0)
+		}
+	}
+
+	if ctx, err := os.ReadFile(filepath.Join(dir, "attr", "current")); err == nil {
+		info.SeContext = strings.TrimRight(string(ctx), "\x00\n")
+	}
+
+	info.UserId = info.Uid / perUserRange
+	info.AppId = info.Uid % perUserRange
+	info.IsIsolated = info.AppId >= firstIsolatedUid && info.AppId <= lastIsolatedUid
+	info.IsAppZygote = strings.Contains(info.SeContext, ":app_zygote:") ||
+		(isApplicationAppId(info.AppId) && strings.HasSuffix(info.Proc, "_zygote"))
+
+	return info, nil
+}
+
+// packageForUid 根据 appId 查找包名，返回包名与是否为共享 uid
+func (r *ProcResolver) packageForUid(appId int, proc string) (string, bool) {
+	pkgs := r.packagesForAppId(appId)
+	switch len(pkgs) {
+	case 0:
+		return "", false
+	case 1:
+		return pkgs[0], false
+	}
+
+	// 共享 uid：优先选择与进程名匹配的包
+	for _, pkg := range pkgs {
+		if procBelongsTo(proc, pkg) {
+			return pkg, true
+		}
+	}
+	return pkgs[0], true
+}
+
+// packageForProcName 通过进程名（pkg 或 pkg:xxx 或 pkg_zygote）查找已安装的包
+func (r *ProcResolver) packageForProcName(proc string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reloadLocked()
+
+	for _, pkgs := range r.byAppId {
+		for _, pkg := range pkgs {
+			if procBelongsTo(proc, pkg) {
+				return pkg
+			}
+		}
+	}
+	return ""
+}
+
+func (r *ProcResolver) packagesForAppId(appId int) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reloadLocked()
+	return r.byAppId[appId]
+}
+
+// PackagesForAppId 返回 appId 对应的全部包名
+func (r *ProcResolver) PackagesForAppId(appId int) []string {
+	pkgs := r.packagesForAppId(appId)
+	return append([]string(nil), pkgs...)
+}
+
+// reloadLocked 在 packages.list 变化时重新加载（已加锁）
+func (r *ProcResolver) reloadLocked() {
+	st, err := os.Stat(r.packagesList)
+	if err != nil {
+		return
+	}
+	if st.ModTime().Equal(r.listMtime) {
+		return
+	}
+
+	data, err := os.ReadFile(r.packagesList)
+	if err != nil {
+		return
+	}
+
+	// 每行格式：<pkg> <uid> <debuggable> <dataDir> <seinfo> <gids>
+	byAppId := make(map[int][]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		uid, err := strconv.Atoi(fields[1])
+		if err != nil {
+			continue
+		}
+		appId := uid % perUserRange
+		byAppId[appId] = append(byAppId[appId], fields[0])
+	}
+	for _, pkgs := range byAppId {
+		sort.Strings(pkgs)
+	}
+
+	r.byAppId = byAppId
+	r.listMtime = st.ModTime()
+}
+
+func procBelongsTo(proc, pkg string) bool {
+	return proc == pkg || strings.HasPrefix(proc, pkg+":") || proc == pkg+"_zygote"
+}
+
+func isApplicationAppId(appId int) bool {
+	return appId >= firstApplicationUid && appId <= lastApplicationUid
+}
+
+func isAppZygoteIsolatedAppId(appId int) bool {
+	return appId >= firstAppZygoteIsolatedId && appId <= lastAppZygoteIsolatedId
+}
+
+func isZygoteName(proc string) bool {
+	switch proc {
+	case "zygote", "zygote64", "usap32", "usap64", "webview_zygote":
+		return true
+	}
+	return false
+}
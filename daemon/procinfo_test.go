@@ -0,0 +1,192 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProc 伪造的进程：status 中的 Name/PPid/Uid、cmdline 与 SELinux 上下文
+type fakeProc struct {
+	pid     int
+	ppid    int
+	uid     int
+	name    string
+	cmdline []string // 为空时不写 cmdline 内容（内核线程）
+	context string
+}
+
+const testPackagesList = `com.example.app 10050 0 /data/user/0/com.example.app default:targetSdkVersion=33 3003
+com.shared.one 10060 0 /data/user/0/com.shared.one platform 3003
+com.shared.two 10060 0 /data/user/0/com.shared.two platform 3003
+com.zygote.host 10070 0 /data/user/0/com.zygote.host default 3003
+com.parent.app 10080 0 /data/user/0/com.parent.app default 3003
+`
+
+// newFakeProcRoot 在临时目录中生成 /proc 结构与 packages.list
+func newFakeProcRoot(t *testing.T, procs []fakeProc) (string, string) {
+	t.Helper()
+	root := t.TempDir()
+	procRoot := filepath.Join(root, "proc")
+	for _, p := range procs {
+		dir := filepath.Join(procRoot, strconv.Itoa(p.pid))
+		if err := os.MkdirAll(filepath.Join(dir, "attr"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		status := "Name:\t" + p.name + "\nState:\tS (sleeping)\nPPid:\t" + strconv.Itoa(p.ppid) +
+			"\nUid:\t" + strings.Repeat(strconv.Itoa(p.uid)+"\t", 4) + "\n"
+		writeTestFile(t, filepath.Join(dir, "status"), status)
+		cmdline := ""
+		if len(p.cmdline) > 0 {
+			cmdline = strings.Join(p.cmdline, "\x00") + "\x00"
+		}
+		writeTestFile(t, filepath.Join(dir, "cmdline"), cmdline)
+		if p.context != "" {
+			writeTestFile(t, filepath.Join(dir, "attr", "current"), p.context+"\x00")
+		}
+	}
+
+	packagesList := filepath.Join(root, "packages.list")
+	writeTestFile(t, packagesList, testPackagesList)
+	return procRoot, packagesList
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcResolverResolve(t *testing.T) {
+	procs := []fakeProc{
+		{pid: 1, ppid: 0, uid: 0, name: "init", cmdline: []string{"/system/bin/init", "second_stage"}},
+		{pid: 10, ppid: 1, uid: 0, name: "zygote64", cmdline: []string{"zygote64"}, context: "u:r:zygote:s0"},
+		{pid: 100, ppid: 10, uid: 10050, name: "com.example.app", cmdline: []string{"com.example.app"}},
+		{pid: 101, ppid: 10, uid: 1010050, name: "com.example.app", cmdline: []string{"com.example.app"}},
+		{pid: 102, ppid: 10, uid: 10050, name: "e.app:service", cmdline: []string{"com.example.app:service", "--flag"}},
+		{pid: 110, ppid: 10, uid: 10060, name: "ared.two:remote", cmdline: []string{"com.shared.two:remote"}},
+		{pid: 111, ppid: 10, uid: 10060, name: "unrelated", cmdline: []string{"unrelated"}},
+		{pid: 120, ppid: 10, uid: 10070, name: "host_zygote", cmdline: []string{"com.zygote.host_zygote"}, context: "u:r:app_zygote:s0:c512,c768"},
+		{pid: 121, ppid: 120, uid: 90005, name: "com.zygote.host", cmdline: []string{"com.zygote.host:svc"}, context: "u:r:isolated_app:s0"},
+		{pid: 130, ppid: 10, uid: 99010, name: "sandboxed", cmdline: []string{"com.example.app:sandboxed"}},
+		{pid: 140, ppid: 10, uid: 10080, name: "com.parent.app", cmdline: []string{"com.parent.app"}},
+		{pid: 141, ppid: 140, uid: 10090, name: "helper", cmdline: []string{"helper"}},
+		{pid: 150, ppid: 1, uid: 1000, name: "system_server", cmdline: []string{"system_server"}},
+		{pid: 160, ppid: 1, uid: 0, name: "kworker/0:1"},
+		{pid: 170, ppid: 10, uid: 10099, name: "orphan", cmdline: []string{"com.not.installed"}},
+	}
+	procRoot, packagesList := newFakeProcRoot(t, procs)
+	r := NewProcResolver(procRoot, packagesList)
+
+	tests := []struct {
+		name        string
+		pid         int
+		wantPkg     string
+		wantReason  string
+		wantProc    string
+		wantUserId  int
+		zygoteChild bool
+		isolated    bool
+		child       bool
+	}{
+		{name: "primary uid", pid: 100, wantPkg: "com.example.app", wantReason: ReasonByUidPrimary, wantProc: "com.example.app"},
+		{name: "secondary user", pid: 101, wantPkg: "com.example.app", wantReason: ReasonByUidPrimary, wantProc: "com.example.app", wantUserId: 10},
+		{name: "cmdline argv0 wins over truncated name", pid: 102, wantPkg: "com.example.app", wantReason: ReasonByUidPrimary, wantProc: "com.example.app:service"},
+		{name: "shared uid matched by process name", pid: 110, wantPkg: "com.shared.two", wantReason: ReasonByUidShared, wantProc: "com.shared.two:remote"},
+		{name: "shared uid without name match", pid: 111, wantPkg: "com.shared.one", wantReason: ReasonByUidShared, wantProc: "unrelated"},
+		{name: "app zygote child", pid: 121, wantPkg: "com.zygote.host", wantReason: ReasonByAppZygote, wantProc: "com.zygote.host:svc", zygoteChild: true},
+		{name: "isolated by process name", pid: 130, wantPkg: "com.example.app", wantReason: ReasonByProcName, wantProc: "com.example.app:sandboxed", isolated: true},
+		{name: "child process falls back to parent", pid: 141, wantPkg: "com.parent.app", wantReason: ReasonByParent, wantProc: "helper", child: true},
+		{name: "system uid", pid: 150, wantReason: ReasonSystemUid, wantProc: "system_server"},
+		{name: "kernel thread uses status name", pid: 160, wantReason: ReasonSystemUid, wantProc: "kworker/0:1"},
+		{name: "app uid without package", pid: 170, wantReason: ReasonUnknown, wantProc: "com.not.installed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := r.Resolve(tt.pid)
+			if err != nil {
+				t.Fatalf("Resolve(%d): %v", tt.pid, err)
+			}
+			if info.PackageName != tt.wantPkg || info.ResolutionReason != tt.wantReason {
+				t.Errorf("got %q/%s, want %q/%s", info.PackageName, info.ResolutionReason, tt.wantPkg, tt.wantReason)
+			}
+			if info.Proc != tt.wantProc {
+				t.Errorf("proc = %q, want %q", info.Proc, tt.wantProc)
+			}
+			if info.UserId != tt.wantUserId {
+				t.Errorf("userId = %d, want %d", info.UserId, tt.wantUserId)
+			}
+			if info.IsAppZygoteChild != tt.zygoteChild || info.IsIsolated != tt.isolated || info.IsChildProcess != tt.child {
+				t.Errorf("zygoteChild/isolated/child = %v/%v/%v, want %v/%v/%v",
+					info.IsAppZygoteChild, info.IsIsolated, info.IsChildProcess, tt.zygoteChild, tt.isolated, tt.child)
+			}
+		})
+	}
+}
+
+func TestProcResolverAppZygoteDetection(t *testing.T) {
+	procs := []fakeProc{
+		{pid: 120, ppid: 1, uid: 10070, name: "host_zygote", cmdline: []string{"com.zygote.host_zygote"}, context: "u:r:app_zygote:s0"},
+		{pid: 122, ppid: 1, uid: 10070, name: "host", cmdline: []string{"com.zygote.host_zygote"}},
+		{pid: 123, ppid: 1, uid: 10070, name: "host", cmdline: []string{"com.zygote.host"}, context: "u:r:untrusted_app:s0"},
+	}
+	procRoot, packagesList := newFakeProcRoot(t, procs)
+	r := NewProcResolver(procRoot, packagesList)
+
+	tests := []struct {
+		pid         int
+		wantZygote  bool
+		wantContext string
+	}{
+		{pid: 120, wantZygote: true, wantContext: "u:r:app_zygote:s0"},
+		{pid: 122, wantZygote: true},
+		{pid: 123, wantZygote: false, wantContext: "u:r:untrusted_app:s0"},
+	}
+	for _, tt := range tests {
+		info, err := r.Resolve(tt.pid)
+		if err != nil {
+			t.Fatalf("Resolve(%d): %v", tt.pid, err)
+		}
+		if info.IsAppZygote != tt.wantZygote || info.SeContext != tt.wantContext {
+			t.Errorf("pid %d: zygote=%v context=%q, want %v %q", tt.pid, info.IsAppZygote, info.SeContext, tt.wantZygote, tt.wantContext)
+		}
+	}
+}
+
+func TestProcResolverErrors(t *testing.T) {
+	procRoot, packagesList := newFakeProcRoot(t, []fakeProc{{pid: 1, uid: 0, name: "init"}})
+	writeTestFile(t, filepath.Join(procRoot, "1", "status"), "Name:\tinit\nPPid:\t0\n")
+	r := NewProcResolver(procRoot, packagesList)
+
+	if _, err := r.Resolve(2); err == nil {
+		t.Error("Resolve of a missing pid should fail")
+	}
+	if _, err := r.Resolve(1); err == nil {
+		t.Error("Resolve without a Uid line should fail")
+	}
+}
+
+func TestProcResolverReloadsPackagesList(t *testing.T) {
+	procRoot, packagesList := newFakeProcRoot(t, nil)
+	r := NewProcResolver(procRoot, packagesList)
+
+	if got := r.PackagesForAppId(10060); len(got) != 2 || got[0] != "com.shared.one" || got[1] != "com.shared.two" {
+		t.Fatalf("PackagesForAppId(10060) = %v", got)
+	}
+
+	writeTestFile(t, packagesList, "com.new.app 10200 0 /data/user/0/com.new.app default 3003\n")
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(packagesList, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if got := r.PackagesForAppId(10200); len(got) != 1 || got[0] != "com.new.app" {
+		t.Errorf("after reload PackagesForAppId(10200) = %v", got)
+	}
+	if got := r.PackagesForAppId(10060); len(got) != 0 {
+		t.Errorf("after reload PackagesForAppId(10060) = %v, want none", got)
+	}
+}
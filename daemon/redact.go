@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// 脱敏参数
+const (
+	maxRedactRules       = 32
+	defaultRedactReplace = "***"
+)
+
+// redactFields 可脱敏的条目字段
+var redactFields = map[string]bool{"path": true, "mapped": true, "uri": true, "proc": true}
+
+// defaultRedactFields 未指定 fields 时脱敏的字段
+var defaultRedactFields = []string{"path", "mapped", "uri"}
+
+// RedactRule 脱敏规则：将条目字段中匹配正则的部分替换为 replace
+type RedactRule struct {
+	ID       string   `json:"id"`
+	Disabled bool     `json:"disabled,omitempty"`
+	Pkg      string   `json:"pkg,omitempty"`     // 为空时应用于所有应用
+	Pattern  string   `json:"pattern"`           // RE2 正则，例如 "/Download/[^/]*@[^/]*"
+	Replace  string   `json:"replace,omitempty"` // 支持 $1 等分组引用，默认 "***"
+	Fields   []string `json:"fields,omitempty"`  // path mapped uri proc，默认 path mapped uri
+}
+
+// validateRedactRules 校验脱敏规则，name 为出错时报告的配置项名称
+func validateRedactRules(rules []RedactRule, name string) error {
+	if len(rules) > maxRedactRules {
+		return fmt.Errorf("%s must not contain more than %d rules", name, maxRedactRules)
+	}
+	ids := make(map[string]bool)
+	for i := range rules {
+		r := &rules[i]
+		if r.ID == "" {
+			return fmt.Errorf("%s[%d].id is required", name, i)
+		}
+		if ids[r.ID] {
+			return fmt.Errorf("%s[%d].id %q is duplicated", name, i, r.ID)
+		}
+		ids[r.ID] = true
+
+		if r.Pattern == "" {
+			return fmt.Errorf("%s[%d].pattern is required", name, i)
+		}
+		if _, err := regexp.Compile(r.Pattern); err != nil {
+			return fmt.Errorf("%s[%d].pattern is invalid: %v", name, i, err)
+		}
+		if r.Replace == "" {
+			r.Replace = defaultRedactReplace
+		}
+		for _, f := range r.Fields {
+			if !redactFields[f] {
+				return fmt.Errorf("%s[%d].fields: unknown field %q (path, mapped, uri, proc)", name, i, f)
+			}
+		}
+	}
+	return nil
+}
+
+// compiledRedactRule 已编译的脱敏规则
+type compiledRedactRule struct {
+	RedactRule
+	re *regexp.Regexp
+}
+
+func compileRedactRule(r RedactRule) (compiledRedactRule, error) {
+	c := compiledRedactRule{RedactRule: r}
+	if c.Replace == "" {
+		c.Replace = defaultRedactReplace
+	}
+	if len(c.Fields) == 0 {
+		c.Fields = defaultRedactFields
+	}
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return c, err
+	}
+	c.re = re
+	return c, nil
+}
+
+// redactField 返回条目中可脱敏字段的指针
+func redactField(e *LogEntry, field string) *string {
+	switch field {
+	case "path":
+		return &e.Path
+	case "mapped":
+		return &e.Mapped
+	case "uri":
+		return &e.URI
+	case "proc":
+		return &e.Proc
+	}
+	return nil
+}
+
+// apply 对条目应用规则，返回是否有字段被修改
+func (r *compiledRedactRule) apply(e *LogEntry) bool {
+	if r.Pkg != "" && e.Pkg != r.Pkg {
+		return false
+	}
+	changed := false
+	for _, f := range r.Fields {
+		p := redactField(e, f)
+		if p == nil || *p == "" {
+			continue
+		}
+		if v := r.re.ReplaceAllString(*p, r.Replace); v != *p {
+			*p = v
+			changed = true
+		}
+	}
+	return changed
+}
+
+// logRedactor 写入时的脱敏规则（对应全局配置 redaction）
+type logRedactor struct {
+	mu       sync.RWMutex
+	rules    []compiledRedactRule
+	redacted int64 // 写入时被脱敏的条目数
+}
+
+// compileRedactRules 编译启用的规则，跳过无法编译的规则并通过 skip 报告
+func compileRedactRules(rules []RedactRule, skip func(RedactRule, error)) []compiledRedactRule {
+	compiled := make([]compiledRedactRule, 0, len(rules))
+	for _, r := range rules {
+		if r.Disabled {
+			continue
+		}
+		c, err := compileRedactRule(r)
+		if err != nil {
+			if skip != nil {
+				skip(r, err)
+			}
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled
+}
+
+// redactEntry 依次应用规则，返回是否有字段被修改
+func redactEntry(rules []compiledRedactRule, e *LogEntry) bool {
+	changed := false
+	for i := range rules {
+		if rules[i].apply(e) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// apply 对新到达的条目应用写入时脱敏规则
+func (r *logRedactor) apply(e *LogEntry) {
+	r.mu.RLock()
+	rules := r.rules
+	r.mu.RUnlock()
+	if len(rules) == 0 {
+		return
+	}
+
+	if redactEntry(rules, e) {
+		r.mu.Lock()
+		r.redacted++
+		r.mu.Unlock()
+	}
+}
+
+// status 返回写入时脱敏状态（对应 status.logs.logging.redaction）
+func (r *logRedactor) status() map[string]interface{} {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]string, 0, len(r.rules))
+	for _, c := range r.rules {
+		ids = append(ids, c.ID)
+	}
+	return map[string]interface{}{
+		"rules":    ids,
+		"redacted": r.redacted,
+	}
+}
+
+// SetRedaction 设置写入时的脱敏规则
+func (l *Logger) SetRedaction(rules []RedactRule) {
+	compiled := compileRedactRules(rules, func(r RedactRule, err error) {
+		l.dlog.Log("warn", "log", "Skipping redaction rule %s: %v", r.ID, err)
+	})
+
+	l.redact.mu.Lock()
+	defer l.redact.mu.Unlock()
+	l.redact.rules = compiled
+}
+
+// Delete 删除匹配 filter 的条目（缓冲区先写入存储），返回删除的条目数；
+// dryRun 时只统计不删除
+func (l *Logger) Delete(filter *LogFilter, dryRun bool) (int, error) {
+	if err := l.Flush(); err != nil {
+		return 0, err
+	}
+
+	if dryRun {
+		n := 0
+		err := l.store.Scan(filter, func(*LogEntry) bool {
+			n++
+			return true
+		})
+		return n, err
+	}
+
+	l.mu.Lock()
+	seq := l.seq
+	l.mu.Unlock()
+
+	if err := l.saveSeqMark(seq); err != nil {
+		return 0, err
+	}
+	n, err := l.store.RemoveWhere(filter)
+	l.integ.prune(seq, n, "delete")
+	return n, err
+}
+
+// Redact 对已写入的匹配 filter 的条目应用脱敏规则，rules 为空时使用配置中的规则，
+// 返回修改的条目数；dryRun 时只统计不修改
+func (l *Logger) Redact(filter *LogFilter, rules []RedactRule, dryRun bool) (int, error) {
+	if err := l.Flush(); err != nil {
+		return 0, err
+	}
+
+	var compiled []compiledRedactRule
+	if len(rules) > 0 {
+		compiled = compileRedactRules(rules, nil)
+	} else {
+		l.redact.mu.RLock()
+		compiled = l.redact.rules
+		l.redact.mu.RUnlock()
+	}
+	if len(compiled) == 0 {
+		return 0, nil
+	}
+
+	if dryRun {
+		n := 0
+		err := l.store.Scan(filter, func(e *LogEntry) bool {
+			c := *e
+			if redactEntry(compiled, &c) {
+				n++
+			}
+			return true
+		})
+		return n, err
+	}
+
+	l.mu.Lock()
+	seq := l.seq
+	l.mu.Unlock()
+
+	// 带哈希的条目记入签名检查点，log.verify 据此区分脱敏与篡改
+	var hashed []int64
+	n, err := l.store.UpdateWhere(filter, func(e *LogEntry) bool {
+		if !redactEntry(compiled, e) {
+			return false
+		}
+		if e.Hash != "" {
+			hashed = append(hashed, e.Seq)
+		}
+		return true
+	})
+	sort.Slice(hashed, func(i, j int) bool { return hashed[i] < hashed[j] })
+	l.integ.redacted(seq, hashed, "redact")
+	return n, err
+}
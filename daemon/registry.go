@@ -0,0 +1,345 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 注册表清理参数
+const (
+	registryReapInterval = 5 * time.Second
+	registryMinTTL       = 10 * time.Second
+	heartbeatTTLFactor   = 3 // 超过 N 个心跳周期未上报视为失联
+)
+
+// RuntimeProcess 已注入并连接到 daemon 的进程
+type RuntimeProcess struct {
+	Pid            int    `json:"pid"`
+	Uid            int    `json:"uid"`
+	Pkg            string `json:"pkg"`
+	Proc           string `json:"proc"`
+	RuleSetVersion int    `json:"ruleSetVersion"`
+	RegisteredAt   int64  `json:"registeredAt"`
+	LastSeenAt     int64  `json:"lastSeenAt"`
+	StaleSince     int64  `json:"staleSince,omitempty"`
+	RefreshPending bool   `json:"refreshPending,omitempty"`
+}
+
+// AppRuntime 单个应用的运行时状态
+type AppRuntime struct {
+	Applied        bool             `json:"applied"`
+	RuleSetVersion int              `json:"ruleSetVersion"`
+	Processes      []RuntimeProcess `json:"processes"`
+}
+
+// ProcessRegistry 记录通过 proc.hello 注册的进程，并清理已退出或失联的进程
+type ProcessRegistry struct {
+	procRoot      string
+	configManager *ConfigManager
+	logger        *Logger
+
+	mu    sync.RWMutex
+	procs map[int]*RuntimeProcess
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewProcessRegistry 创建进程注册表
+func NewProcessRegistry(procRoot string, cm *ConfigManager, logger *Logger) *ProcessRegistry {
+	r := &ProcessRegistry{
+		procRoot:      procRoot,
+		configManager: cm,
+		logger:        logger,
+		procs:         make(map[int]*RuntimeProcess),
+		stopCh:        make(chan struct{}),
+	}
+
+	// 配置版本递增时记录各进程开始落后的时间
+	cm.Watch(r.markStale)
+
+	return r
+}
+
+// Start 启动清理循环
+func (r *ProcessRegistry) Start() {
+	r.wg.Add(1)
+	go r.reapLoop()
+}
+
+// Stop 停止清理循环
+func (r *ProcessRegistry) Stop() {
+	close(r.stopCh)
+	r.wg.Wait()
+}
+
+// Register 注册进程（同一 pid 重复注册会覆盖旧记录）
+func (r *ProcessRegistry) Register(p RuntimeProcess) RuntimeProcess {
+	version := r.configManager.GetVersion()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	p.RegisteredAt = now
+	p.LastSeenAt = now
+	p.StaleSince = 0
+	p.RefreshPending = false
+	if p.RuleSetVersion < version {
+		p.StaleSince = now
+	}
+	r.procs[p.Pid] = &p
+	return p
+}
+
+// Heartbeat 刷新进程的存活时间与已应用的规则版本
+//
+// 返回进程是否已注册，以及是否有待处理的刷新请求（返回后即清除）。
+func (r *ProcessRegistry) Heartbeat(pid, ruleSetVersion int) (ok bool, refresh bool) {
+	version := r.configManager.GetVersion()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.procs[pid]
+	if !ok {
+		return false, false
+	}
+
+	p.LastSeenAt = time.Now().UnixMilli()
+	if ruleSetVersion > 0 {
+		r.setAppliedLocked(p, ruleSetVersion, version)
+	}
+
+	refresh = p.RefreshPending
+	p.RefreshPending = false
+	return true, refresh
+}
+
+// ReportApplied 记录进程已应用的规则版本，返回更新后的记录
+func (r *ProcessRegistry) ReportApplied(pid, ruleSetVersion int) (RuntimeProcess, bool) {
+	version := r.configManager.GetVersion()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.procs[pid]
+	if !ok {
+		return RuntimeProcess{}, false
+	}
+
+	p.LastSeenAt = time.Now().UnixMilli()
+	r.setAppliedLocked(p, ruleSetVersion, version)
+	return *p, true
+}
+
+// setAppliedLocked 更新已应用版本，追上当前版本时清除落后标记（已加锁）
+func (r *ProcessRegistry) setAppliedLocked(p *RuntimeProcess, applied, current int) {
+	p.RuleSetVersion = applied
+	if applied >= current {
+		p.StaleSince = 0
+		p.RefreshPending = false
+	} else if p.StaleSince == 0 {
+		p.StaleSince = time.Now().UnixMilli()
+	}
+}
+
+// markStale 配置版本递增后标记尚未应用新版本的进程
+func (r *ProcessRegistry) markStale(version int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	for _, p := range r.procs {
+		if p.RuleSetVersion < version && p.StaleSince == 0 {
+			p.StaleSince = now
+		}
+	}
+}
+
+// Stale 列出落后于当前配置版本超过 window 的进程，pkg 为空时不按包过滤
+func (r *ProcessRegistry) Stale(pkg string, window time.Duration) []RuntimeProcess {
+	version := r.configManager.GetVersion()
+	deadline := time.Now().Add(-window).UnixMilli()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := []RuntimeProcess{}
+	for _, p := range r.procs {
+		if pkg != "" && p.Pkg != pkg {
+			continue
+		}
+		if p.RuleSetVersion >= version || p.StaleSince == 0 || p.StaleSince > deadline {
+			continue
+		}
+		result = append(result, *p)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].StaleSince < result[j].StaleSince
+	})
+	return result
+}
+
+// RequestRefresh 标记进程需要重新加载规则，在下一次心跳时下发
+//
+// pid 大于 0 时只处理该进程；否则处理 pkg 的全部进程；
+// 两者都为空时处理全部落后于当前版本的进程。返回被标记的 pid。
+func (r *ProcessRegistry) RequestRefresh(pid int, pkg string) []int {
+	version := r.configManager.GetVersion()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pids := []int{}
+	for _, p := range r.procs {
+		switch {
+		case pid > 0:
+			if p.Pid != pid {
+				continue
+			}
+		case pkg != "":
+			if p.Pkg != pkg {
+				continue
+			}
+		default:
+			if p.RuleSetVersion >= version {
+				continue
+			}
+		}
+		p.RefreshPending = true
+		pids = append(pids, p.Pid)
+	}
+
+	sort.Ints(pids)
+	return pids
+}
+
+// Unregister 注销进程
+func (r *ProcessRegistry) Unregister(pid int) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.procs[pid]; !ok {
+		return false
+	}
+	delete(r.procs, pid)
+	return true
+}
+
+// List 列出全部已注册进程，按包名与 pid 排序
+func (r *ProcessRegistry) List() []RuntimeProcess {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	result := make([]RuntimeProcess, 0, len(r.procs))
+	for _, p := range r.procs {
+		result = append(result, *p)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Pkg != result[j].Pkg {
+			return result[i].Pkg < result[j].Pkg
+		}
+		return result[i].Pid < result[j].Pid
+	})
+	return result
+}
+
+// AppRuntime 获取应用的运行时状态
+//
+// 至少有一个进程已应用当前版本的规则时视为已生效；
+// RuleSetVersion 为各进程中最旧的已应用版本。
+func (r *ProcessRegistry) AppRuntime(pkg string) AppRuntime {
+	version := r.configManager.GetVersion()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rt := AppRuntime{Processes: []RuntimeProcess{}}
+	for _, p := range r.procs {
+		if p.Pkg != pkg {
+			continue
+		}
+		rt.Processes = append(rt.Processes, *p)
+		if p.RuleSetVersion >= version {
+			rt.Applied = true
+		}
+		if rt.RuleSetVersion == 0 || p.RuleSetVersion < rt.RuleSetVersion {
+			rt.RuleSetVersion = p.RuleSetVersion
+		}
+	}
+
+	sort.Slice(rt.Processes, func(i, j int) bool {
+		return rt.Processes[i].Pid < rt.Processes[j].Pid
+	})
+	return rt
+}
+
+// Summary 返回连接进程数与活跃应用数
+func (r *ProcessRegistry) Summary() (int, int) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	apps := make(map[string]bool)
+	for _, p := range r.procs {
+		apps[p.Pkg] = true
+	}
+	return len(r.procs), len(apps)
+}
+
+// ttl 返回失联判定时间，随心跳周期（pollIntervalMs）变化
+func (r *ProcessRegistry) ttl() time.Duration {
+	poll := time.Duration(r.configManager.GetGlobalConfig().Update.PollIntervalMs) * time.Millisecond
+	ttl := poll * heartbeatTTLFactor
+	if ttl < registryMinTTL {
+		ttl = registryMinTTL
+	}
+	return ttl
+}
+
+func (r *ProcessRegistry) reapLoop() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(registryReapInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-ticker.C:
+			if n := r.reap(time.Now()); n > 0 {
+				r.logger.Infof("registry", "Removed %d dead process(es) from registry", n)
+			}
+		}
+	}
+}
+
+// reap 移除已退出或超时未心跳的进程
+func (r *ProcessRegistry) reap(now time.Time) int {
+	deadline := now.Add(-r.ttl()).UnixMilli()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	removed := 0
+	for pid, p := range r.procs {
+		if p.LastSeenAt < deadline || !r.alive(pid) {
+			delete(r.procs, pid)
+			removed++
+		}
+	}
+	return removed
+}
+
+// alive 检查进程是否仍存在
+func (r *ProcessRegistry) alive(pid int) bool {
+	_, err := os.Stat(filepath.Join(r.procRoot, strconv.Itoa(pid)))
+	return !os.IsNotExist(err)
+}
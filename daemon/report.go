@@ -0,0 +1,147 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// 目录报告参数
+const (
+	maxReportDepth = 16
+	maxReportNodes = 5000 // 超出后事件计入已有的最深上级目录
+)
+
+// 目录报告中操作的分类，未列出的操作只计入 total
+var (
+	reportReadOps   = map[string]bool{"open": true, "openat": true, "open_uri": true, "read": true, "pread": true, "readv": true, "opendir": true, "stat": true, "access": true}
+	reportWriteOps  = map[string]bool{"write": true, "pwrite": true, "writev": true, "truncate": true, "rename": true, "chmod": true}
+	reportCreateOps = map[string]bool{"creat": true, "mkdir": true, "mknod": true, "link": true, "symlink": true}
+	reportDeleteOps = map[string]bool{"unlink": true, "unlinkat": true, "rmdir": true}
+
+	// 目标本身是目录的操作，路径最后一段也作为目录节点
+	reportDirOps = map[string]bool{"mkdir": true, "rmdir": true, "opendir": true}
+)
+
+// PathNode 目录树节点，计数包含所有下级目录
+type PathNode struct {
+	Name       string      `json:"name"`
+	Path       string      `json:"path"`
+	Total      int         `json:"total"`
+	Reads      int         `json:"reads"`
+	Writes     int         `json:"writes"`
+	Creates    int         `json:"creates"`
+	Deletes    int         `json:"deletes"`
+	Denied     int         `json:"denied"`
+	LastAccess int64       `json:"lastAccess"`
+	Children   []*PathNode `json:"children,omitempty"`
+
+	children map[string]*PathNode
+}
+
+// PathReport 应用的目录使用报告
+type PathReport struct {
+	Pkg       string    `json:"pkg"`
+	Depth     int       `json:"depth"`
+	Nodes     int       `json:"nodes"`
+	Unplaced  int       `json:"unplaced"`  // 没有绝对路径的事件（如仅有 uri）
+	Truncated bool      `json:"truncated"` // 节点数达到上限
+	Root      *PathNode `json:"root"`
+}
+
+// add 将事件计入节点
+func (n *PathNode) add(e *LogEntry, events int) {
+	n.Total += events
+	switch {
+	case reportReadOps[e.Op]:
+		n.Reads += events
+	case reportWriteOps[e.Op]:
+		n.Writes += events
+	case reportCreateOps[e.Op]:
+		n.Creates += events
+	case reportDeleteOps[e.Op]:
+		n.Deletes += events
+	}
+	if isDenyDecision(e.Decision) {
+		n.Denied += events
+	}
+	n.LastAccess = max(n.LastAccess, e.Ts, e.LastTs)
+}
+
+// finish 将子节点按事件数降序排列
+func (n *PathNode) finish() {
+	for _, c := range n.children {
+		c.finish()
+		n.Children = append(n.Children, c)
+	}
+	sort.Slice(n.Children, func(i, j int) bool {
+		if n.Children[i].Total != n.Children[j].Total {
+			return n.Children[i].Total > n.Children[j].Total
+		}
+		return n.Children[i].Name < n.Children[j].Name
+	})
+	n.children = nil
+}
+
+// PathReport 扫描匹配条目，按路径的前 depth 级目录生成目录树
+//
+// 每个事件计入从根到其所在目录（超过 depth 级时截断）的每个节点，
+// 文件名本身不单独成为节点（mkdir、rmdir、opendir 的目标除外）。
+// 去重合并或限流汇总的条目按其 count 计入。
+func (l *Logger) PathReport(filter LogFilter, depth int) (*PathReport, error) {
+	if depth <= 0 {
+		depth = defaultPathDepth
+	}
+	depth = min(depth, maxReportDepth)
+
+	l.Flush()
+
+	report := &PathReport{
+		Pkg:   filter.Pkg,
+		Depth: depth,
+		Nodes: 1,
+		Root:  &PathNode{Name: "/", Path: "/", children: make(map[string]*PathNode)},
+	}
+	err := l.store.Scan(&filter, func(e *LogEntry) bool {
+		n := e.events()
+		if !strings.HasPrefix(e.Path, "/") {
+			report.Unplaced += n
+			return true
+		}
+
+		// 最后一段为文件名，不单独成为节点
+		parts := strings.Split(strings.Trim(e.Path, "/"), "/")
+		if !reportDirOps[e.Op] {
+			parts = parts[:len(parts)-1]
+		}
+		if len(parts) > depth {
+			parts = parts[:depth]
+		}
+
+		node := report.Root
+		node.add(e, n)
+		for _, name := range parts {
+			if name == "" {
+				continue
+			}
+			child, ok := node.children[name]
+			if !ok {
+				if report.Nodes >= maxReportNodes {
+					report.Truncated = true
+					break
+				}
+				child = &PathNode{Name: name, Path: strings.TrimSuffix(node.Path, "/") + "/" + name, children: make(map[string]*PathNode)}
+				node.children[name] = child
+				report.Nodes++
+			}
+			child.add(e, n)
+			node = child
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.Root.finish()
+	return report, nil
+}
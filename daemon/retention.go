@@ -0,0 +1,265 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// LogRetention 单个应用的日志保留限制，字段为 0 表示不限制
+//
+// GlobalConfig.LogRetention 为每个应用的默认值，AppConfig.LogRetention
+// 中非 0 的字段覆盖默认值。
+type LogRetention struct {
+	MaxEntries int   `json:"maxEntries,omitempty"`
+	MaxBytes   int64 `json:"maxBytes,omitempty"`
+	MaxAgeDays int   `json:"maxAgeDays,omitempty"`
+}
+
+// IsZero 判断是否没有任何限制
+func (r LogRetention) IsZero() bool {
+	return r.MaxEntries == 0 && r.MaxBytes == 0 && r.MaxAgeDays == 0
+}
+
+// merge 用 override 中非 0 的字段覆盖当前值
+func (r LogRetention) merge(override *LogRetention) LogRetention {
+	if override == nil {
+		return r
+	}
+	if override.MaxEntries != 0 {
+		r.MaxEntries = override.MaxEntries
+	}
+	if override.MaxBytes != 0 {
+		r.MaxBytes = override.MaxBytes
+	}
+	if override.MaxAgeDays != 0 {
+		r.MaxAgeDays = override.MaxAgeDays
+	}
+	return r
+}
+
+func validateLogRetention(r *LogRetention, field string) error {
+	if r == nil {
+		return nil
+	}
+	if r.MaxEntries < 0 || r.MaxBytes < 0 || r.MaxAgeDays < 0 {
+		return fmt.Errorf("%s.maxEntries/maxBytes/maxAgeDays must not be negative", field)
+	}
+	if r.MaxAgeDays > 3650 {
+		return fmt.Errorf("%s.maxAgeDays must not exceed 3650", field)
+	}
+	return nil
+}
+
+// LogRetentionFor 返回应用生效的日志保留限制
+func (cm *ConfigManager) LogRetentionFor(pkg string) LogRetention {
+	cm.mu.RLock()
+	defer cm.mu.RUnlock()
+
+	retention := cm.globalConfig.LogRetention
+	if app, ok := cm.appsCache[pkg]; ok {
+		retention = retention.merge(app.LogRetention)
+	}
+	return retention
+}
+
+// PkgUsage 单个应用在日志存储中的占用
+type PkgUsage struct {
+	Pkg      string `json:"pkg"`
+	Entries  int    `json:"entries"`
+	Bytes    int64  `json:"bytes"`
+	OldestTs int64  `json:"oldestTs"`
+	NewestTs int64  `json:"newestTs"`
+}
+
+// sortedUsage 按占用字节数降序返回各应用的占用
+func sortedUsage(usage map[string]*PkgUsage) []PkgUsage {
+	result := make([]PkgUsage, 0, len(usage))
+	for _, u := range usage {
+		result = append(result, *u)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Bytes != result[j].Bytes {
+			return result[i].Bytes > result[j].Bytes
+		}
+		return result[i].Pkg < result[j].Pkg
+	})
+	return result
+}
+
+// retentionSlack 超出条目数/字节数限制的比例达到该值才清理，避免持续写入时每轮都重写分段
+const retentionSlack = 0.1
+
+// retentionBudget 执行保留限制时单个应用还需删除的量
+type retentionBudget struct {
+	dropEntries int
+	dropBytes   int64
+	cutoff      int64 // 早于该时间的条目删除
+}
+
+// Retain 按应用的保留限制删除超出的最旧条目，返回各应用删除的条目数
+//
+// 条目按分段顺序（即写入顺序）从旧到新删除，只重写包含需删除条目的分段。
+// 超出条目数或字节数限制 retentionSlack 以上时才清理，清理后回到限制以内。
+func (s *logStore) Retain(policies map[string]LogRetention, now time.Time) (map[string]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	usage := s.usageLocked()
+	budgets := make(map[string]*retentionBudget)
+	for pkg, policy := range policies {
+		u, ok := usage[pkg]
+		if !ok || policy.IsZero() {
+			continue
+		}
+		b := &retentionBudget{}
+		if policy.MaxEntries > 0 && float64(u.Entries) > float64(policy.MaxEntries)*(1+retentionSlack) {
+			b.dropEntries = u.Entries - policy.MaxEntries
+		}
+		if policy.MaxBytes > 0 && float64(u.Bytes) > float64(policy.MaxBytes)*(1+retentionSlack) {
+			b.dropBytes = u.Bytes - policy.MaxBytes
+		}
+		if policy.MaxAgeDays > 0 {
+			b.cutoff = now.AddDate(0, 0, -policy.MaxAgeDays).UnixMilli()
+		}
+		if b.dropEntries > 0 || b.dropBytes > 0 || u.OldestTs < b.cutoff {
+			budgets[pkg] = b
+		}
+	}
+
+	removed := make(map[string]int)
+	if len(budgets) == 0 {
+		return removed, nil
+	}
+
+	s.closeActiveLocked()
+
+	for _, seg := range s.segments {
+		if !segmentNeedsRetention(seg, budgets) {
+			continue
+		}
+		cost := segmentEntryCost(seg)
+
+		_, err := s.rewriteSegmentLocked(seg, func(e *LogEntry) bool {
+			b, ok := budgets[e.Pkg]
+			if !ok {
+				return true
+			}
+			if e.Ts < b.cutoff {
+				removed[e.Pkg]++
+				return false
+			}
+			if b.dropEntries > 0 || b.dropBytes > 0 {
+				b.dropEntries--
+				b.dropBytes -= cost[e.Pkg]
+				removed[e.Pkg]++
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return removed, err
+		}
+	}
+
+	s.dropEmptyLocked()
+	return removed, nil
+}
+
+// segmentNeedsRetention 判断分段中是否有需要删除的条目
+func segmentNeedsRetention(seg *segment, budgets map[string]*retentionBudget) bool {
+	for _, blk := range seg.blocks {
+		for pkg, n := range blk.Pkgs {
+			b, ok := budgets[pkg]
+			if !ok || n == 0 {
+				continue
+			}
+			if b.dropEntries > 0 || b.dropBytes > 0 || blk.MinTs < b.cutoff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// segmentEntryCost 按块索引计算分段中各应用每个条目的平均字节数，
+// 与 usageLocked 的统计口径一致（二进制分段为摊销后的编码大小）
+func segmentEntryCost(seg *segment) map[string]int64 {
+	bytes := make(map[string]int64)
+	entries := make(map[string]int)
+	for _, blk := range seg.blocks {
+		for pkg, n := range blk.Pkgs {
+			bytes[pkg] += blk.pkgBytes(pkg)
+			entries[pkg] += n
+		}
+	}
+
+	// 向下取整，宁可多删一两条也要回到限制以内
+	cost := make(map[string]int64, len(entries))
+	for pkg, n := range entries {
+		if n > 0 {
+			cost[pkg] = max(bytes[pkg]/int64(n), 1)
+		}
+	}
+	return cost
+}
+
+// usageLocked 根据索引统计各应用的占用（已加锁）
+func (s *logStore) usageLocked() map[string]*PkgUsage {
+	usage := make(map[string]*PkgUsage)
+	for _, seg := range s.segments {
+		for _, b := range seg.blocks {
+			for pkg, n := range b.Pkgs {
+				if n == 0 {
+					continue
+				}
+				u, ok := usage[pkg]
+				if !ok {
+					u = &PkgUsage{Pkg: pkg, OldestTs: b.MinTs}
+					usage[pkg] = u
+				}
+				u.Entries += n
+				u.Bytes += b.pkgBytes(pkg)
+				// 块内时间范围是所有应用共享的，这里是近似值
+				if b.MinTs < u.OldestTs {
+					u.OldestTs = b.MinTs
+				}
+				if b.MaxTs > u.NewestTs {
+					u.NewestTs = b.MaxTs
+				}
+			}
+		}
+	}
+	return usage
+}
+
+// Usage 返回各应用的日志占用，按字节数降序
+func (l *Logger) Usage() []PkgUsage {
+	l.Flush()
+	return sortedUsage(l.store.Stats().Pkgs)
+}
+
+// EnforceRetention 按各应用的保留限制清理日志，返回各应用删除的条目数
+func (l *Logger) EnforceRetention(policyFor func(pkg string) LogRetention, now time.Time) (map[string]int, error) {
+	l.Flush()
+
+	l.mu.Lock()
+	seq := l.seq
+	l.mu.Unlock()
+
+	if err := l.saveSeqMark(seq); err != nil {
+		return nil, err
+	}
+
+	policies := make(map[string]LogRetention)
+	for pkg := range l.store.Stats().Pkgs {
+		policies[pkg] = policyFor(pkg)
+	}
+	removed, err := l.store.Retain(policies, now)
+	total := 0
+	for _, n := range removed {
+		total += n
+	}
+	l.integ.prune(seq, total, "logRetention")
+	return removed, err
+}
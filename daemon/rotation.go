@@ -0,0 +1,172 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// rotationInterval 轮转检查周期
+const rotationInterval = time.Minute
+
+// LogRotator 定期轮转访问日志：按配置切换分段、压缩旧分段并执行保留限制与全局容量上限
+//
+// 分段切换发生在写入时（跨天或超过大小），这里负责把配置同步到 Logger、
+// 压缩超过 compressAfterDays 的分段、按应用的 logRetention 删除超出的条目，
+// 以及在超过 maxLogSizeMB 时删除最旧的分段。
+type LogRotator struct {
+	configManager *ConfigManager
+	logger        *Logger
+
+	mu              sync.Mutex
+	lastRunAt       int64
+	nextRunAt       int64
+	lastError       string
+	compressedTotal int
+	deletedTotal    int
+
+	wakeCh chan struct{}
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewLogRotator 创建日志轮转器
+func NewLogRotator(cm *ConfigManager, logger *Logger) *LogRotator {
+	r := &LogRotator{
+		configManager: cm,
+		logger:        logger,
+		wakeCh:        make(chan struct{}, 1),
+		stopCh:        make(chan struct{}),
+	}
+
+	r.apply()
+
+	// 配置变更后立即应用新的容量与轮转设置
+	cm.Watch(func(int) { r.Wake() })
+
+	return r
+}
+
+// Start 启动轮转循环
+func (r *LogRotator) Start() {
+	r.wg.Add(1)
+	go r.loop()
+}
+
+// Stop 停止轮转循环
+func (r *LogRotator) Stop() {
+	close(r.stopCh)
+	r.wg.Wait()
+}
+
+// Wake 通知轮转器立即执行一次
+func (r *LogRotator) Wake() {
+	select {
+	case r.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (r *LogRotator) loop() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(rotationInterval)
+	defer ticker.Stop()
+
+	r.run(time.Now())
+
+	for {
+		select {
+		case <-r.stopCh:
+			return
+		case <-r.wakeCh:
+			r.apply()
+			r.run(time.Now())
+		case <-ticker.C:
+			r.run(time.Now())
+		}
+	}
+}
+
+// apply 将全局配置同步到 Logger
+func (r *LogRotator) apply() {
+	global := r.configManager.GetGlobalConfig()
+	r.logger.SetMaxSize(global.MaxLogSizeMB)
+	r.logger.SetRotation(global.LogRotation.Mode == "daily", int64(global.LogRotation.SegmentSizeMB)*1024*1024)
+	r.logger.SetEncoding(global.LogEncoding == encodingBinary)
+}
+
+// run 执行一次压缩与容量清理
+func (r *LogRotator) run(now time.Time) {
+	cfg := r.configManager.GetGlobalConfig().LogRotation
+
+	var errMsg string
+	compressed := 0
+	if cfg.CompressAfterDays > 0 {
+		n, err := r.logger.Compress(now.AddDate(0, 0, -cfg.CompressAfterDays))
+		if err != nil {
+			errMsg = err.Error()
+			r.logger.Errorf("rotation", "Failed to compress log segments: %v", err)
+		}
+		compressed = n
+	}
+
+	// 先按应用的保留限制清理，再执行全局容量上限
+	retained, err := r.logger.EnforceRetention(r.configManager.LogRetentionFor, now)
+	if err != nil {
+		errMsg = err.Error()
+		r.logger.Errorf("rotation", "Failed to enforce log retention: %v", err)
+	}
+	for pkg, n := range retained {
+		r.logger.Infof("rotation", "Log retention removed %d entries of %s", n, pkg)
+	}
+
+	deleted, err := r.logger.Cleanup()
+	if err != nil {
+		errMsg = err.Error()
+		r.logger.Errorf("rotation", "Failed to clean up log segments: %v", err)
+	}
+	if deleted > 0 {
+		r.logger.Warnf("rotation", "Log size cap reached, deleted %d oldest segment(s)", deleted)
+	}
+
+	r.mu.Lock()
+	r.lastRunAt = now.UnixMilli()
+	r.nextRunAt = now.Add(rotationInterval).UnixMilli()
+	r.lastError = errMsg
+	r.compressedTotal += compressed
+	r.deletedTotal += deleted
+	r.mu.Unlock()
+}
+
+// Status 返回轮转与清理状态（对应 status.logs.rotation / status.logs.cleanup）
+func (r *LogRotator) Status() (map[string]interface{}, map[string]interface{}) {
+	global := r.configManager.GetGlobalConfig()
+	cfg := global.LogRotation
+	st := r.logger.store.Stats()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rotation := map[string]interface{}{
+		"mode":               cfg.Mode,
+		"segmentSizeBytes":   int64(cfg.SegmentSizeMB) * 1024 * 1024,
+		"compressAfterDays":  cfg.CompressAfterDays,
+		"activeSegment":      st.Active,
+		"segments":           st.Segments,
+		"compressedSegments": st.Compressed,
+		"encoding":           global.LogEncoding,
+		"binarySegments":     st.Binary,
+		"compressedTotal":    r.compressedTotal,
+		"lastRunAt":          r.lastRunAt,
+		"nextRunAt":          r.nextRunAt,
+	}
+	cleanup := map[string]interface{}{
+		"policy":          "globalCapDeleteOldest",
+		"retention":       global.LogRetention,
+		"deletedSegments": r.deletedTotal,
+	}
+	if r.lastError != "" {
+		cleanup["lastError"] = r.lastError
+	}
+	return rotation, cleanup
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scheduleLoc 计算每周时间段使用的时区，启动时由 loadDeviceLocation 设置
+//
+// Android 上 Go 的 time.Local 固定为 UTC，不能直接使用。
+var scheduleLoc = time.Local
+
+// loadDeviceLocation 获取设备时区：优先使用 SR_TIMEZONE，其次读取 persist.sys.timezone
+func loadDeviceLocation() (*time.Location, error) {
+	name := os.Getenv("SR_TIMEZONE")
+	if name == "" {
+		out, err := exec.Command("getprop", "persist.sys.timezone").Output()
+		if err != nil {
+			return nil, fmt.Errorf("getprop persist.sys.timezone: %w", err)
+		}
+		name = strings.TrimSpace(string(out))
+	}
+	if name == "" {
+		return nil, fmt.Errorf("device time zone is not set")
+	}
+	return time.LoadLocation(name)
+}
+
+// Activation 规则生效时间窗口（可嵌入规则与应用配置）
+//
+// ActiveFrom/ActiveUntil 为毫秒时间戳，0 表示不限制；
+// Schedule 为每周重复的时间段，为空表示全天生效。
+type Activation struct {
+	ActiveFrom  int64            `json:"activeFrom,omitempty"`
+	ActiveUntil int64            `json:"activeUntil,omitempty"`
+	Schedule    []ScheduleWindow `json:"schedule,omitempty"`
+}
+
+// ScheduleWindow 每周时间段
+//
+// Days 取值 0-6（0 为周日，与 time.Weekday 一致），为空表示每天；
+// Start/End 为设备时区（scheduleLoc）的 "HH:MM"，End 不大于 Start 时表示跨越午夜。
+type ScheduleWindow struct {
+	Days  []int  `json:"days,omitempty"`
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// IsActive 判断在指定时间是否生效
+func (a *Activation) IsActive(now time.Time) bool {
+	ms := now.UnixMilli()
+	if a.ActiveFrom > 0 && ms < a.ActiveFrom {
+		return false
+	}
+	if a.ActiveUntil > 0 && ms >= a.ActiveUntil {
+		return false
+	}
+	if len(a.Schedule) == 0 {
+		return true
+	}
+
+	for _, w := range a.Schedule {
+		if w.contains(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextTransition 返回 now 之后最近一次可能的生效状态切换时间，没有则返回零值
+func (a *Activation) NextTransition(now time.Time) time.Time {
+	var next time.Time
+	consider := func(t time.Time) {
+		if t.After(now) && (next.IsZero() || t.Before(next)) {
+			next = t
+		}
+	}
+
+	if a.ActiveFrom > 0 {
+		consider(time.UnixMilli(a.ActiveFrom))
+	}
+	if a.ActiveUntil > 0 {
+		consider(time.UnixMilli(a.ActiveUntil))
+	}
+
+	// 已过期的规则不会再切换
+	if a.ActiveUntil > 0 && now.UnixMilli() >= a.ActiveUntil {
+		return next
+	}
+
+	local := now.In(scheduleLoc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, scheduleLoc)
+	for _, w := range a.Schedule {
+		startMin, _ := parseClock(w.Start)
+		endMin, _ := parseClock(w.End)
+		// 从前一天开始，覆盖跨越午夜的时间段
+		for d := -1; d <= 7; d++ {
+			day := midnight.AddDate(0, 0, d)
+			if !w.matchesDay(day.Weekday()) {
+				continue
+			}
+			start, end := w.bounds(day, startMin, endMin)
+			consider(start)
+			consider(end)
+		}
+	}
+
+	return next
+}
+
+func (w *ScheduleWindow) contains(now time.Time) bool {
+	startMin, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	endMin, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+
+	local := now.In(scheduleLoc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, scheduleLoc)
+	// 今天开始的时间段，或昨天开始并跨越午夜的时间段
+	for _, day := range []time.Time{midnight, midnight.AddDate(0, 0, -1)} {
+		if !w.matchesDay(day.Weekday()) {
+			continue
+		}
+		start, end := w.bounds(day, startMin, endMin)
+		if !now.Before(start) && now.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *ScheduleWindow) matchesDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+// bounds 计算某天（设备时区）开始的时间段的起止时间
+func (w *ScheduleWindow) bounds(day time.Time, startMin, endMin int) (time.Time, time.Time) {
+	day = day.In(scheduleLoc)
+	start := time.Date(day.Year(), day.Month(), day.Day(), startMin/60, startMin%60, 0, 0, scheduleLoc)
+	endDay := day
+	if endMin <= startMin {
+		endDay = day.AddDate(0, 0, 1)
+	}
+	end := time.Date(endDay.Year(), endDay.Month(), endDay.Day(), endMin/60, endMin%60, 0, 0, scheduleLoc)
+	return start, end
+}
+
+// parseClock 解析 "HH:MM"，返回从午夜开始的分钟数
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	if h < 0 || h > 23 || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+func validateActivation(a *Activation, field string) error {
+	if a.ActiveFrom < 0 || a.ActiveUntil < 0 {
+		return fmt.Errorf("%s.activeFrom/activeUntil must not be negative", field)
+	}
+	if a.ActiveFrom > 0 && a.ActiveUntil > 0 && a.ActiveUntil <= a.ActiveFrom {
+		return fmt.Errorf("%s.activeUntil must be later than activeFrom", field)
+	}
+
+	for i, w := range a.Schedule {
+		if _, err := parseClock(w.Start); err != nil {
+			return fmt.Errorf("%s.schedule[%d].start must be HH:MM", field, i)
+		}
+		if _, err := parseClock(w.End); err != nil {
+			return fmt.Errorf("%s.schedule[%d].end must be HH:MM", field, i)
+		}
+		for _, d := range w.Days {
+			if d < 0 || d > 6 {
+				return fmt.Errorf("%s.schedule[%d].days must be between 0 and 6", field, i)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Scheduler 在规则生效状态切换或临时覆盖到期时递增配置版本，使客户端重新拉取配置
+type Scheduler struct {
+	configManager *ConfigManager
+	logger        *Logger
+	wakeCh        chan struct{}
+	stopCh        chan struct{}
+	wg            sync.WaitGroup
+}
+
+// NewScheduler 创建调度器
+func NewScheduler(cm *ConfigManager, logger *Logger) *Scheduler {
+	s := &Scheduler{
+		configManager: cm,
+		logger:        logger,
+		wakeCh:        make(chan struct{}, 1),
+		stopCh:        make(chan struct{}),
+	}
+
+	// 配置变更后重新计算下一次切换时间
+	cm.Watch(func(int) { s.Wake() })
+
+	return s
+}
+
+// Start 启动调度循环
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go s.loop()
+}
+
+// Stop 停止调度循环
+func (s *Scheduler) Stop() {
+	close(s.stopCh)
+	s.wg.Wait()
+}
+
+// Wake 通知调度器重新计算
+func (s *Scheduler) Wake() {
+	select {
+	case s.wakeCh <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Scheduler) loop() {
+	defer s.wg.Done()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		next := s.configManager.NextTransition(time.Now())
+
+		// 没有待切换的规则时也定期醒来，防止系统时间被调整后错过
+		wait := time.Hour
+		if !next.IsZero() {
+			if d := time.Until(next); d < wait {
+				wait = d
+			}
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-s.stopCh:
+			return
+		case <-s.wakeCh:
+		case <-timer.C:
+			if next.IsZero() || time.Now().Before(next) {
+				continue
+			}
+
+			// 清理到期的临时覆盖（会自行递增版本）
+			removed, err := s.configManager.PruneOverrides(time.Now())
+			if err != nil {
+				s.logger.Errorf("scheduler", "Failed to prune overrides: %v", err)
+			}
+			if removed > 0 {
+				s.logger.Infof("scheduler", "Expired %d app override(s), config version -> %d", removed, s.configManager.GetVersion())
+				continue
+			}
+
+			version := s.configManager.BumpVersion()
+			s.logger.Infof("scheduler", "Rule activation changed, config version -> %d", version)
+		}
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -44,7 +46,7 @@ func (s *Server) Start() error {
 	// 设置权限
 	os.Chmod(s.socketPath, 0666)
 
-	s.daemon.logger.Printf("Server listening on %s", s.socketPath)
+	s.daemon.logger.Infof("server", "Server listening on %s", s.socketPath)
 
 	go s.acceptLoop()
 	return nil
@@ -73,7 +75,7 @@ func (s *Server) acceptLoop() {
 			case <-s.stopCh:
 				return
 			default:
-				s.daemon.logger.Printf("Accept error: %v", err)
+				s.daemon.logger.Errorf("server", "Accept error: %v", err)
 				continue
 			}
 		}
@@ -89,6 +91,7 @@ func (s *Server) handleConnection(conn net.Conn) {
 
 	reader := bufio.NewReader(conn)
 	writer := bufio.NewWriter(conn)
+	peer := connPeerCred(conn)
 
 	for {
 		// 设置读取超时
@@ -110,6 +113,25 @@ func (s *Server) handleConnection(conn net.Conn) {
 			s.writeError(writer, "E_IPC_PROTOCOL", "Invalid request format", "")
 			continue
 		}
+		req.peer = peer
+
+		// 订阅请求会一直占用连接，直到客户端断开或服务器停止
+		if req.Cmd == "log.follow" {
+			s.handleLogFollow(conn, reader, writer, req.Params)
+			return
+		}
+		if req.Cmd == "alert.follow" {
+			s.handleAlertFollow(conn, reader, writer, req.Params)
+			return
+		}
+
+		// 流式导出会在同一连接上连续发送多行
+		if req.Cmd == "log.export" {
+			if !s.handleLogExport(conn, writer, req.Params) {
+				return
+			}
+			continue
+		}
 
 		// 处理请求
 		resp := s.handleRequest(&req)
@@ -126,6 +148,8 @@ func (s *Server) handleConnection(conn net.Conn) {
 type Request struct {
 	Cmd    string          `json:"cmd"`
 	Params json.RawMessage `json:"params,omitempty"`
+
+	peer peerCred // 连接对端凭据，由 handleConnection 填入
 }
 
 // Response IPC响应
@@ -167,7 +191,7 @@ func (s *Server) handleRequest(req *Request) Response {
 	case "global.get":
 		return s.handleGlobalGet()
 	case "global.set":
-		return s.handleGlobalSet(req.Params)
+		return s.handleGlobalSet(req.Params, req.peer)
 	case "monitor.get":
 		return s.handleMonitorGet()
 	case "monitor.set":
@@ -180,16 +204,58 @@ func (s *Server) handleRequest(req *Request) Response {
 		return s.handleAppList()
 	case "app.delete":
 		return s.handleAppDelete(req.Params)
+	case "app.suspend":
+		return s.handleAppSuspend(req.Params, req.peer)
+	case "app.override":
+		return s.handleAppOverride(req.Params, req.peer)
+	case "app.restore":
+		return s.handleAppRestore(req.Params, req.peer)
+	case "app.overrides":
+		return s.handleAppOverrides()
 	case "log.tail":
 		return s.handleLogTail(req.Params)
 	case "log.query":
 		return s.handleLogQuery(req.Params)
 	case "log.clear":
-		return s.handleLogClear(req.Params)
+		return s.handleLogClear(req.Params, req.peer)
 	case "log.stats":
 		return s.handleLogStats()
+	case "log.aggregate":
+		return s.handleLogAggregate(req.Params)
+	case "report.paths":
+		return s.handleReportPaths(req.Params)
+	case "log.sessions":
+		return s.handleLogSessions(req.Params)
+	case "log.delete":
+		return s.handleLogDelete(req.Params, req.peer)
+	case "log.redact":
+		return s.handleLogRedact(req.Params, req.peer)
+	case "log.convert":
+		return s.handleLogConvert(req.Params)
+	case "log.verify":
+		return s.handleLogVerify()
+	case "alert.list":
+		return s.handleAlertList(req.Params)
+	case "daemon.logs":
+		return s.handleDaemonLogs(req.Params)
 	case "diag.whoami":
 		return s.handleDiagWhoami(req.Params)
+	case "proc.attribute":
+		return s.handleProcAttribute(req.Params)
+	case "proc.hello":
+		return s.handleProcHello(req.Params, req.peer)
+	case "proc.heartbeat":
+		return s.handleProcHeartbeat(req.Params, req.peer)
+	case "proc.bye":
+		return s.handleProcBye(req.Params, req.peer)
+	case "proc.list":
+		return s.handleProcList()
+	case "proc.applied":
+		return s.handleProcApplied(req.Params, req.peer)
+	case "proc.refresh":
+		return s.handleProcRefresh(req.Params, req.peer)
+	case "runtime.stale":
+		return s.handleRuntimeStale(req.Params)
 	default:
 		return Response{
 			Ok: false,
@@ -215,6 +281,11 @@ func (s *Server) handlePing() Response {
 
 func (s *Server) handleStatus() Response {
 	stats := s.daemon.logger.GetStats()
+	stats["rotation"], stats["cleanup"] = s.daemon.rotator.Status()
+	stats["flush"] = s.daemon.flusher.Status()
+	connected, appsActive := s.daemon.registry.Summary()
+	window := time.Duration(s.daemon.configManager.GetGlobalConfig().Update.PollIntervalMs) * time.Millisecond
+	stale := s.daemon.registry.Stale("", window)
 
 	return Response{
 		Ok: true,
@@ -223,6 +294,7 @@ func (s *Server) handleStatus() Response {
 				"pid":       os.Getpid(),
 				"startedAt": time.Now().Add(-time.Minute).UnixMilli(), // 简化
 				"version":   Version,
+				"log":       s.daemon.logger.dlog.Status(),
 			},
 			"config": map[string]interface{}{
 				"configDir":     s.daemon.configDir,
@@ -230,12 +302,16 @@ func (s *Server) handleStatus() Response {
 				"lastLoadedAt":  time.Now().UnixMilli(),
 			},
 			"runtime": map[string]interface{}{
+				"connectedProcesses": connected,
+				"appsActive":         appsActive,
+				"staleProcesses":     len(stale),
 				"socket": map[string]interface{}{
 					"path":      s.socketPath,
 					"listening": s.listener != nil,
 				},
 			},
-			"logs": stats,
+			"logs":   stats,
+			"alerts": s.daemon.logger.alerts.Status(),
 		},
 	}
 }
@@ -251,7 +327,7 @@ func (s *Server) handleGlobalGet() Response {
 	}
 }
 
-func (s *Server) handleGlobalSet(params json.RawMessage) Response {
+func (s *Server) handleGlobalSet(params json.RawMessage, peer peerCred) Response {
 	var req struct {
 		Global *GlobalConfig `json:"global"`
 	}
@@ -264,6 +340,32 @@ func (s *Server) handleGlobalSet(params json.RawMessage) Response {
 			},
 		}
 	}
+	if req.Global == nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Missing global parameter",
+				Field:   "global",
+			},
+		}
+	}
+
+	// 告警命令由守护进程以 root 执行，只允许 root 客户端新增或修改
+	if !peer.isRoot() {
+		current := s.daemon.configManager.GetGlobalConfig()
+		if i := changedAlertCommand(current.Alerts, req.Global.Alerts); i >= 0 {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_PERMISSION",
+					Message: "Only root may set alert commands",
+					Field:   fmt.Sprintf("alerts[%d].command", i),
+					Hint:    "以 root 身份运行 daemonctl global set",
+				},
+			}
+		}
+	}
 
 	if err := s.daemon.configManager.SaveGlobalConfig(req.Global); err != nil {
 		return Response{
@@ -351,15 +453,21 @@ func (s *Server) handleAppGet(params json.RawMessage) Response {
 		}
 	}
 
+	effective, _ := s.daemon.configManager.GetEffectiveAppConfig(req.Pkg, time.Now())
+	override, _ := s.daemon.configManager.GetOverride(req.Pkg)
+
 	return Response{
 		Ok: true,
 		Data: map[string]interface{}{
-			"pkg": req.Pkg,
-			"app": app,
+			"pkg":       req.Pkg,
+			"app":       app,
+			"effective": effective,
+			"override":  override,
 			"counts": map[string]int{
 				"redirect": len(app.RedirectRules),
 				"readOnly": len(app.ReadOnlyRules),
 			},
+			"runtime":       s.daemon.registry.AppRuntime(req.Pkg),
 			"configVersion": s.daemon.configManager.GetVersion(),
 		},
 	}
@@ -401,6 +509,14 @@ func (s *Server) handleAppSet(params json.RawMessage) Response {
 
 func (s *Server) handleAppList() Response {
 	apps := s.daemon.configManager.ListApps()
+	for _, app := range apps {
+		rt := s.daemon.registry.AppRuntime(app["pkg"].(string))
+		app["applied"] = rt.Applied
+		app["runtime"] = map[string]interface{}{
+			"processCount":   len(rt.Processes),
+			"ruleSetVersion": rt.RuleSetVersion,
+		}
+	}
 	return Response{
 		Ok: true,
 		Data: map[string]interface{}{
@@ -442,10 +558,150 @@ func (s *Server) handleAppDelete(params json.RawMessage) Response {
 	}
 }
 
-func (s *Server) handleLogTail(params json.RawMessage) Response {
+func (s *Server) handleAppSuspend(params json.RawMessage, peer peerCred) Response {
+	// 临时覆盖会改变所有钩子进程读取的生效配置，只允许 root 客户端
+	if !peer.isRoot() {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_PERMISSION",
+				Message: "app.suspend requires a root client",
+			},
+		}
+	}
+
+	var req struct {
+		Pkg        string `json:"pkg"`
+		DurationMs int64  `json:"durationMs"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil || req.Pkg == "" {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Missing pkg parameter",
+			},
+		}
+	}
+
+	if !isValidPackageName(req.Pkg) {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Invalid package name: " + req.Pkg,
+				Field:   "pkg",
+			},
+		}
+	}
+
+	override, err := s.daemon.configManager.SuspendApp(req.Pkg, time.Duration(req.DurationMs)*time.Millisecond)
+	if err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: err.Error(),
+				Field:   "durationMs",
+			},
+		}
+	}
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"pkg":           req.Pkg,
+			"override":      override,
+			"configVersion": s.daemon.configManager.GetVersion(),
+		},
+	}
+}
+
+func (s *Server) handleAppOverride(params json.RawMessage, peer peerCred) Response {
+	// 与 app.suspend 相同，只允许 root 客户端
+	if !peer.isRoot() {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_PERMISSION",
+				Message: "app.override requires a root client",
+			},
+		}
+	}
+
+	var req struct {
+		Pkg   string     `json:"pkg"`
+		App   *AppConfig `json:"app"`
+		TtlMs int64      `json:"ttlMs"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil || req.Pkg == "" || req.App == nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Missing pkg or app parameter",
+			},
+		}
+	}
+
+	if !isValidPackageName(req.Pkg) {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Invalid package name: " + req.Pkg,
+				Field:   "pkg",
+			},
+		}
+	}
+
+	if req.TtlMs <= 0 {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "ttlMs must be positive",
+				Field:   "ttlMs",
+			},
+		}
+	}
+
+	override, err := s.daemon.configManager.OverrideApp(req.Pkg, req.App, time.Duration(req.TtlMs)*time.Millisecond)
+	if err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_CFG_VALIDATION",
+				Message: err.Error(),
+				Field:   "app",
+			},
+		}
+	}
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"pkg":           req.Pkg,
+			"override":      override,
+			"configVersion": s.daemon.configManager.GetVersion(),
+		},
+	}
+}
+
+func (s *Server) handleAppRestore(params json.RawMessage, peer peerCred) Response {
+	// 移除覆盖同样会改变生效配置，只允许 root 客户端
+	if !peer.isRoot() {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_PERMISSION",
+				Message: "app.restore requires a root client",
+			},
+		}
+	}
+
 	var req struct {
 		Pkg string `json:"pkg"`
-		N   int    `json:"n"`
 	}
 	if err := json.Unmarshal(params, &req); err != nil || req.Pkg == "" {
 		return Response{
@@ -457,6 +713,73 @@ func (s *Server) handleLogTail(params json.RawMessage) Response {
 		}
 	}
 
+	if !isValidPackageName(req.Pkg) {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Invalid package name: " + req.Pkg,
+				Field:   "pkg",
+			},
+		}
+	}
+
+	found, err := s.daemon.configManager.RestoreApp(req.Pkg)
+	if err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_CFG_WRITE",
+				Message: err.Error(),
+			},
+		}
+	}
+	if !found {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_NOT_FOUND",
+				Message: "No override for app: " + req.Pkg,
+			},
+		}
+	}
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"configVersion": s.daemon.configManager.GetVersion(),
+		},
+	}
+}
+
+func (s *Server) handleAppOverrides() Response {
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"overrides":     s.daemon.configManager.ListOverrides(),
+			"configVersion": s.daemon.configManager.GetVersion(),
+		},
+	}
+}
+
+func (s *Server) handleLogTail(params json.RawMessage) Response {
+	var req struct {
+		Pkg string `json:"pkg"`
+		N   int    `json:"n"`
+	}
+	// pkg 为空时返回所有应用的最近日志
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid parameters",
+				},
+			}
+		}
+	}
+
 	if req.N <= 0 {
 		req.N = 10
 	}
@@ -486,21 +809,28 @@ func (s *Server) handleLogTail(params json.RawMessage) Response {
 
 func (s *Server) handleLogQuery(params json.RawMessage) Response {
 	var req struct {
-		Pkg      string   `json:"pkg"`
-		From     int64    `json:"from"`
-		To       int64    `json:"to"`
-		Ops      []string `json:"ops"`
-		Contains string   `json:"contains"`
-		Limit    int      `json:"limit"`
-		Offset   int      `json:"offset"`
+		Pkg       string   `json:"pkg"`
+		From      int64    `json:"from"`
+		To        int64    `json:"to"`
+		Ops       []string `json:"ops"`
+		Decisions []string `json:"decisions"`
+		Contains  string   `json:"contains"`
+		Where     string   `json:"where"`
+		Limit     int      `json:"limit"`
+		Offset    int      `json:"offset"`
+		Cursor    string   `json:"cursor"`
 	}
-	if err := json.Unmarshal(params, &req); err != nil || req.Pkg == "" {
-		return Response{
-			Ok: false,
-			Error: &ErrorInfo{
-				Code:    "E_ARG",
-				Message: "Missing pkg parameter",
-			},
+	// pkg 为空时跨应用查询，结果中附带按应用分组的计数
+	// cursor 为上一页返回的 nextCursor，翻页期间有新日志写入也不会重复或遗漏
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid parameters",
+				},
+			}
 		}
 	}
 
@@ -511,7 +841,55 @@ func (s *Server) handleLogQuery(params json.RawMessage) Response {
 		req.Limit = 1000
 	}
 
-	entries, total, err := s.daemon.logger.Query(req.Pkg, req.From, req.To, req.Ops, req.Contains, req.Limit, req.Offset)
+	filter := LogFilter{
+		Pkg:       req.Pkg,
+		From:      req.From,
+		To:        req.To,
+		Ops:       req.Ops,
+		Decisions: req.Decisions,
+		Contains:  req.Contains,
+	}
+	if req.Where != "" {
+		where, err := ParseLogQuery(req.Where)
+		if err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid where expression: " + err.Error(),
+					Field:   "where",
+					Hint:    `例如: decision=DENY_RO and path~"/DCIM/**" and errno!=0`,
+				},
+			}
+		}
+		filter.Where = where
+	}
+	if req.Cursor != "" {
+		if req.Offset > 0 {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "cursor and offset cannot be combined",
+					Field:   "offset",
+				},
+			}
+		}
+		cursor, err := ParseLogCursor(req.Cursor)
+		if err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid cursor: " + err.Error(),
+					Field:   "cursor",
+					Hint:    "cursor 应原样使用上一页返回的 nextCursor",
+				},
+			}
+		}
+		filter.After = cursor
+	}
+	entries, total, err := s.daemon.logger.Query(filter, req.Limit, req.Offset)
 	if err != nil {
 		return Response{
 			Ok: false,
@@ -522,37 +900,78 @@ func (s *Server) handleLogQuery(params json.RawMessage) Response {
 		}
 	}
 
+	// 使用游标时 total 为游标之后的匹配数
 	nextOffset := req.Offset + len(entries)
 	if nextOffset >= total {
 		nextOffset = -1
 	}
+	nextCursor := ""
+	if nextOffset != -1 && len(entries) > 0 {
+		nextCursor = cursorOf(&entries[len(entries)-1]).Encode()
+	}
+	if req.Cursor != "" {
+		nextOffset = -1
+	}
+
+	data := map[string]interface{}{
+		"pkg":        req.Pkg,
+		"entries":    entries,
+		"total":      total,
+		"nextOffset": nextOffset,
+		"nextCursor": nextCursor,
+	}
+
+	if req.Pkg == "" {
+		packages, err := s.daemon.logger.CountByPkg(filter)
+		if err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_LOG_IO",
+					Message: err.Error(),
+				},
+			}
+		}
+		data["packages"] = packages
+	}
 
 	return Response{
-		Ok: true,
-		Data: map[string]interface{}{
-			"pkg":        req.Pkg,
-			"entries":    entries,
-			"total":      total,
-			"nextOffset": nextOffset,
-		},
+		Ok:   true,
+		Data: data,
 	}
 }
 
-func (s *Server) handleLogClear(params json.RawMessage) Response {
+// handleLogConvert 将已有日志分段转换为指定编码
+func (s *Server) handleLogConvert(params json.RawMessage) Response {
 	var req struct {
-		Pkg string `json:"pkg"`
+		Encoding string `json:"encoding"`
 	}
-	if err := json.Unmarshal(params, &req); err != nil || req.Pkg == "" {
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid parameters",
+				},
+			}
+		}
+	}
+
+	if !validLogEncoding(req.Encoding) {
 		return Response{
 			Ok: false,
 			Error: &ErrorInfo{
 				Code:    "E_ARG",
-				Message: "Missing pkg parameter",
+				Message: fmt.Sprintf("unknown encoding %q", req.Encoding),
+				Field:   "encoding",
+				Hint:    "可选编码: json, binary",
 			},
 		}
 	}
 
-	if err := s.daemon.logger.Clear(req.Pkg); err != nil {
+	converted, before, after, err := s.daemon.logger.Convert(req.Encoding == encodingBinary)
+	if err != nil {
 		return Response{
 			Ok: false,
 			Error: &ErrorInfo{
@@ -564,43 +983,1431 @@ func (s *Server) handleLogClear(params json.RawMessage) Response {
 
 	return Response{
 		Ok: true,
+		Data: map[string]interface{}{
+			"encoding":    req.Encoding,
+			"segments":    converted,
+			"bytesBefore": before,
+			"bytesAfter":  after,
+			// 新写入的分段仍按 logEncoding 编码
+			"logEncoding": s.daemon.configManager.GetGlobalConfig().LogEncoding,
+		},
 	}
 }
 
-func (s *Server) handleLogStats() Response {
-	stats := s.daemon.logger.GetStats()
+// handleLogVerify 校验日志哈希链与签名检查点
+func (s *Server) handleLogVerify() Response {
+	result, err := s.daemon.logger.Verify()
+	if err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_LOG_IO",
+				Message: err.Error(),
+			},
+		}
+	}
+
 	return Response{
 		Ok: true,
-		Data: stats,
+		Data: map[string]interface{}{
+			"valid":       result.Valid,
+			"entries":     result.Entries,
+			"hashed":      result.Hashed,
+			"unhashed":    result.Unhashed,
+			"firstSeq":    result.FirstSeq,
+			"lastSeq":     result.LastSeq,
+			"missing":     result.Missing,
+			"pruned":      result.Pruned,
+			"redacted":    result.Redacted,
+			"checkpoints": result.Checkpoints,
+			"publicKey":   result.PublicKey,
+			"firstBroken": result.FirstBroken,
+			"findings":    result.Findings,
+		},
 	}
 }
 
-func (s *Server) handleDiagWhoami(params json.RawMessage) Response {
+// handleAlertList 查询最近的告警记录（按时间降序）
+func (s *Server) handleAlertList(params json.RawMessage) Response {
 	var req struct {
-		Pid int `json:"pid"`
+		Rule  string `json:"rule"`
+		Pkg   string `json:"pkg"`
+		Since int64  `json:"since"`
+		Limit int    `json:"limit"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid parameters",
+				},
+			}
+		}
 	}
-	json.Unmarshal(params, &req)
+
+	if req.Limit <= 0 {
+		req.Limit = 50
+	}
+	if req.Limit > maxAlertRecords {
+		req.Limit = maxAlertRecords
+	}
+	// since 为负数时表示相对当前时间的毫秒数
+	if req.Since < 0 {
+		req.Since = time.Now().UnixMilli() + req.Since
+	}
+
+	alerts, total := s.daemon.logger.alerts.List(AlertFilter{
+		Rule:  req.Rule,
+		Pkg:   req.Pkg,
+		Since: req.Since,
+	}, req.Limit)
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"alerts": alerts,
+			"count":  len(alerts),
+			"total":  total,
+		},
+	}
+}
+
+// handleDaemonLogs 读取守护进程自身日志（daemon.log 及其轮转备份）
+func (s *Server) handleDaemonLogs(params json.RawMessage) Response {
+	var req struct {
+		Level     string `json:"level"`
+		Component string `json:"component"`
+		Since     int64  `json:"since"`
+		Contains  string `json:"contains"`
+		Limit     int    `json:"limit"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid parameters",
+				},
+			}
+		}
+	}
+
+	if req.Level != "" {
+		if _, ok := daemonLogLevels[req.Level]; !ok {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: fmt.Sprintf("unknown level %q", req.Level),
+					Field:   "level",
+					Hint:    "可选级别: debug, info, warn, error",
+				},
+			}
+		}
+	}
+	if req.Limit <= 0 {
+		req.Limit = 100
+	}
+	if req.Limit > 1000 {
+		req.Limit = 1000
+	}
+	// since 为负数时表示相对当前时间的毫秒数
+	if req.Since < 0 {
+		req.Since = time.Now().UnixMilli() + req.Since
+	}
+
+	filter := DaemonLogFilter{
+		Level:     req.Level,
+		Component: req.Component,
+		Since:     req.Since,
+		Contains:  req.Contains,
+	}
+	records, err := s.daemon.logger.dlog.Read(filter, req.Limit)
+	if err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_LOG_IO",
+				Message: err.Error(),
+			},
+		}
+	}
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"records": records,
+			"count":   len(records),
+			"path":    s.daemon.logger.dlog.path,
+		},
+	}
+}
+
+func (s *Server) handleLogAggregate(params json.RawMessage) Response {
+	var req struct {
+		Pkg       string   `json:"pkg"`
+		From      int64    `json:"from"`
+		To        int64    `json:"to"`
+		Ops       []string `json:"ops"`
+		Decisions []string `json:"decisions"`
+		Where     string   `json:"where"`
+		GroupBy   []string `json:"groupBy"`
+		PathDepth int      `json:"pathDepth"`
+		TopN      *int     `json:"topN"`
+		Limit     int      `json:"limit"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid parameters",
+				},
+			}
+		}
+	}
+
+	if req.GroupBy == nil {
+		req.GroupBy = []string{}
+	}
+	if req.Limit <= 0 {
+		req.Limit = 50
+	}
+	if req.Limit > 1000 {
+		req.Limit = 1000
+	}
+	// topN 未指定时每组返回 5 个最常访问的路径，0 表示不统计
+	topN := 5
+	if req.TopN != nil {
+		topN = *req.TopN
+	}
+	if topN < 0 {
+		topN = 0
+	}
+	if topN > 100 {
+		topN = 100
+	}
+
+	spec := AggregateSpec{
+		GroupBy:   req.GroupBy,
+		PathDepth: req.PathDepth,
+		TopN:      topN,
+	}
+	if err := spec.Validate(); err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: err.Error(),
+				Field:   "groupBy",
+				Hint:    "可选维度: pkg, op, decision, result, proc, path, hour",
+			},
+		}
+	}
+
+	filter := LogFilter{
+		Pkg:       req.Pkg,
+		From:      req.From,
+		To:        req.To,
+		Ops:       req.Ops,
+		Decisions: req.Decisions,
+	}
+	if req.Where != "" {
+		where, err := ParseLogQuery(req.Where)
+		if err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid where expression: " + err.Error(),
+					Field:   "where",
+					Hint:    `例如: decision=DENY_RO and path~"/DCIM/**" and errno!=0`,
+				},
+			}
+		}
+		filter.Where = where
+	}
+
+	groups, total, err := s.daemon.logger.Aggregate(filter, spec)
+	if err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_LOG_IO",
+				Message: err.Error(),
+			},
+		}
+	}
+
+	groupCount := len(groups)
+	if len(groups) > req.Limit {
+		groups = groups[:req.Limit]
+	}
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"groupBy":    spec.GroupBy,
+			"groups":     groups,
+			"groupCount": groupCount,
+			"total":      total,
+		},
+	}
+}
+
+// handleReportPaths 生成应用的目录使用报告（目录树）
+func (s *Server) handleReportPaths(params json.RawMessage) Response {
+	var req struct {
+		Pkg   string `json:"pkg"`
+		All   bool   `json:"all"`
+		Depth int    `json:"depth"`
+		From  int64  `json:"from"`
+		To    int64  `json:"to"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid parameters",
+				},
+			}
+		}
+	}
+
+	// 报告按应用生成，汇总所有应用需要显式指定 all
+	if req.Pkg == "" && !req.All {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Missing pkg parameter",
+				Field:   "pkg",
+				Hint:    "汇总所有应用请传入 all=true",
+			},
+		}
+	}
+	if req.Depth < 0 || req.Depth > maxReportDepth {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: fmt.Sprintf("depth must be between 1 and %d", maxReportDepth),
+				Field:   "depth",
+				Hint:    "默认 4，即 /storage/emulated/0/<目录>",
+			},
+		}
+	}
+	if req.All {
+		req.Pkg = ""
+	}
+
+	report, err := s.daemon.logger.PathReport(LogFilter{Pkg: req.Pkg, From: req.From, To: req.To}, req.Depth)
+	if err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_LOG_IO",
+				Message: err.Error(),
+			},
+		}
+	}
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"pkg":       report.Pkg,
+			"depth":     report.Depth,
+			"nodes":     report.Nodes,
+			"unplaced":  report.Unplaced,
+			"truncated": report.Truncated,
+			"tree":      report.Root,
+		},
+	}
+}
+
+// handleLogSessions 将带 fd/openId 的条目拼接为文件会话
+//
+// 原生钩子上报 fd/openId 之前没有条目可拼接，结果为空；daemonctl log sessions 直接调用该命令。
+func (s *Server) handleLogSessions(params json.RawMessage) Response {
+	var req struct {
+		Pkg        string `json:"pkg"`
+		From       int64  `json:"from"`
+		To         int64  `json:"to"`
+		PathPrefix string `json:"pathPrefix"`
+		OpenOnly   bool   `json:"openOnly"`
+		MinBytes   int64  `json:"minBytes"`
+		Limit      int    `json:"limit"`
+	}
+	// 打开早于 from 的会话标记为 partial
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid parameters",
+				},
+			}
+		}
+	}
+
+	if req.MinBytes < 0 {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "minBytes must not be negative",
+				Field:   "minBytes",
+			},
+		}
+	}
+	if req.Limit <= 0 {
+		req.Limit = 100
+	}
+	if req.Limit > 1000 {
+		req.Limit = 1000
+	}
+
+	filter := LogFilter{Pkg: req.Pkg, From: req.From, To: req.To}
+	spec := SessionSpec{PathPrefix: req.PathPrefix, OpenOnly: req.OpenOnly, MinBytes: req.MinBytes}
+	sessions, dropped, err := s.daemon.logger.Sessions(filter, spec)
+	if err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_LOG_IO",
+				Message: err.Error(),
+			},
+		}
+	}
+
+	count := len(sessions)
+	openCount := 0
+	for i := range sessions {
+		if !sessions[i].Closed {
+			openCount++
+		}
+	}
+	if len(sessions) > req.Limit {
+		sessions = sessions[:req.Limit]
+	}
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"sessions": sessions,
+			"count":    count,
+			"open":     openCount,
+			"dropped":  dropped,
+		},
+	}
+}
+
+func (s *Server) handleLogClear(params json.RawMessage, peer peerCred) Response {
+	// 删除或改写已记录的日志会破坏审计记录，只允许 root 客户端执行
+	if !peer.isRoot() {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_PERMISSION",
+				Message: "log.clear requires a root client",
+			},
+		}
+	}
+
+	var req struct {
+		Pkg string `json:"pkg"`
+		All bool   `json:"all"`
+	}
+	// 清空全部日志需要显式指定 all，避免漏传 pkg 时误删
+	if err := json.Unmarshal(params, &req); err != nil || (req.Pkg == "" && !req.All) {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Missing pkg parameter",
+				Hint:    "清空所有应用的日志请传入 all=true",
+			},
+		}
+	}
+	if req.Pkg != "" && req.All {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "pkg and all are mutually exclusive",
+				Field:   "all",
+			},
+		}
+	}
+
+	if err := s.daemon.logger.Clear(req.Pkg); err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_LOG_IO",
+				Message: err.Error(),
+			},
+		}
+	}
+
+	return Response{
+		Ok: true,
+	}
+}
+
+// logSelection log.delete / log.redact 的条目选择条件
+type logSelection struct {
+	Pkg        string   `json:"pkg"`
+	From       int64    `json:"from"`
+	To         int64    `json:"to"`
+	PathPrefix string   `json:"pathPrefix"`
+	Ops        []string `json:"ops"`
+	Decisions  []string `json:"decisions"`
+	Contains   string   `json:"contains"`
+	Where      string   `json:"where"`
+}
+
+// filter 将选择条件转换为过滤条件
+func (sel *logSelection) filter() (*LogFilter, error) {
+	filter := &LogFilter{
+		Pkg:        sel.Pkg,
+		From:       sel.From,
+		To:         sel.To,
+		PathPrefix: sel.PathPrefix,
+		Ops:        sel.Ops,
+		Decisions:  sel.Decisions,
+		Contains:   sel.Contains,
+	}
+	if sel.Where != "" {
+		where, err := ParseLogQuery(sel.Where)
+		if err != nil {
+			return nil, err
+		}
+		filter.Where = where
+	}
+	return filter, nil
+}
+
+// empty 是否没有任何条件
+func (sel *logSelection) empty() bool {
+	return sel.Pkg == "" && sel.From == 0 && sel.To == 0 && sel.PathPrefix == "" &&
+		len(sel.Ops) == 0 && len(sel.Decisions) == 0 && sel.Contains == "" && sel.Where == ""
+}
+
+// handleLogDelete 删除匹配条件的日志条目
+func (s *Server) handleLogDelete(params json.RawMessage, peer peerCred) Response {
+	// 与 log.clear 相同，只允许 root 客户端
+	if !peer.isRoot() {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_PERMISSION",
+				Message: "log.delete requires a root client",
+			},
+		}
+	}
+
+	var req struct {
+		logSelection
+		DryRun bool `json:"dryRun"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid parameters",
+				},
+			}
+		}
+	}
+
+	// 不带条件的删除等同于清空，需要使用 log.clear all=true
+	if req.empty() {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "At least one condition is required",
+				Hint:    "可用条件: pkg, from, to, pathPrefix, ops, decisions, contains, where；清空全部日志请使用 log.clear all=true",
+			},
+		}
+	}
+	filter, err := req.filter()
+	if err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Invalid where expression: " + err.Error(),
+				Field:   "where",
+				Hint:    `例如: decision=DENY_RO and path~"/DCIM/**" and errno!=0`,
+			},
+		}
+	}
+
+	removed, err := s.daemon.logger.Delete(filter, req.DryRun)
+	if err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_LOG_IO",
+				Message: err.Error(),
+			},
+		}
+	}
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"removed": removed,
+			"dryRun":  req.DryRun,
+		},
+	}
+}
+
+// handleLogRedact 对已写入的日志条目应用脱敏规则
+func (s *Server) handleLogRedact(params json.RawMessage, peer peerCred) Response {
+	// 脱敏会改写已记录（可能已签名）的条目，只允许 root 客户端
+	if !peer.isRoot() {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_PERMISSION",
+				Message: "log.redact requires a root client",
+			},
+		}
+	}
+
+	var req struct {
+		logSelection
+		Pattern string   `json:"pattern"`
+		Replace string   `json:"replace"`
+		Fields  []string `json:"fields"`
+		DryRun  bool     `json:"dryRun"`
+	}
+	// 不传 pattern 时使用全局配置 redaction 中的规则
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid parameters",
+				},
+			}
+		}
+	}
+
+	var rules []RedactRule
+	if req.Pattern != "" {
+		rules = []RedactRule{{ID: "adhoc", Pattern: req.Pattern, Replace: req.Replace, Fields: req.Fields}}
+		if err := validateRedactRules(rules, "rule"); err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: err.Error(),
+					Field:   "pattern",
+					Hint:    `RE2 正则，例如: "/Download/[^/]*@[^/]*"；fields 可选 path, mapped, uri, proc`,
+				},
+			}
+		}
+	} else if len(s.daemon.configManager.GetGlobalConfig().Redaction) == 0 {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "No pattern given and no redaction rules configured",
+				Field:   "pattern",
+				Hint:    "传入 pattern，或在全局配置 redaction 中添加规则",
+			},
+		}
+	}
+	filter, err := req.filter()
+	if err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Invalid where expression: " + err.Error(),
+				Field:   "where",
+				Hint:    `例如: decision=DENY_RO and path~"/DCIM/**" and errno!=0`,
+			},
+		}
+	}
+
+	redacted, err := s.daemon.logger.Redact(filter, rules, req.DryRun)
+	if err != nil {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_LOG_IO",
+				Message: err.Error(),
+			},
+		}
+	}
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"redacted": redacted,
+			"dryRun":   req.DryRun,
+		},
+	}
+}
+
+func (s *Server) handleLogStats() Response {
+	stats := s.daemon.logger.GetStats()
+
+	// 各应用的占用与生效的保留限制
+	packages := []map[string]interface{}{}
+	for _, u := range s.daemon.logger.Usage() {
+		packages = append(packages, map[string]interface{}{
+			"pkg":       u.Pkg,
+			"entries":   u.Entries,
+			"bytes":     u.Bytes,
+			"oldestTs":  u.OldestTs,
+			"newestTs":  u.NewestTs,
+			"retention": s.daemon.configManager.LogRetentionFor(u.Pkg),
+		})
+	}
+	stats["packages"] = packages
+
+	return Response{
+		Ok: true,
+		Data: stats,
+	}
+}
+
+// followEvent log.follow 推送的事件（每行一个）
+type followEvent struct {
+	Event   string    `json:"event"` // log | heartbeat
+	Ts      int64     `json:"ts,omitempty"`
+	Entry   *LogEntry `json:"entry,omitempty"`
+	Dropped int64     `json:"dropped"`
+}
+
+// followHeartbeatInterval 没有新条目时发送心跳的间隔
+const followHeartbeatInterval = 15 * time.Second
+
+func (s *Server) handleLogFollow(conn net.Conn, reader *bufio.Reader, writer *bufio.Writer, params json.RawMessage) {
+	var req struct {
+		Pkg       string   `json:"pkg"`
+		Ops       []string `json:"ops"`
+		Decisions []string `json:"decisions"`
+		Where     string   `json:"where"`
+		QueueSize int      `json:"queueSize"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			s.writeError(writer, "E_ARG", "Invalid parameters", "")
+			return
+		}
+	}
+
+	filter := LogFilter{
+		Pkg:       req.Pkg,
+		Ops:       req.Ops,
+		Decisions: req.Decisions,
+	}
+	if req.Where != "" {
+		where, err := ParseLogQuery(req.Where)
+		if err != nil {
+			s.writeError(writer, "E_ARG", "Invalid where expression: "+err.Error(), "where")
+			return
+		}
+		filter.Where = where
+	}
+
+	sub := s.daemon.logger.Subscribe(filter, req.QueueSize)
+	defer s.daemon.logger.Unsubscribe(sub)
+
+	ack, _ := json.Marshal(Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"subscriptionId": sub.ID,
+			"queueSize":      cap(sub.ch),
+		},
+	})
+	writer.Write(ack)
+	writer.WriteByte('\n')
+	if err := writer.Flush(); err != nil {
+		return
+	}
+
+	// 客户端不再发送请求，读到 EOF 即视为断开
+	conn.SetReadDeadline(time.Time{})
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, err := reader.ReadString('\n'); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(followHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		var ev followEvent
+		select {
+		case <-s.stopCh:
+			return
+		case <-closed:
+			return
+		case entry := <-sub.C():
+			ev = followEvent{Event: "log", Entry: &entry, Dropped: sub.Dropped()}
+		case <-heartbeat.C:
+			ev = followEvent{Event: "heartbeat", Ts: time.Now().UnixMilli(), Dropped: sub.Dropped()}
+		}
+
+		data, _ := json.Marshal(ev)
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		writer.Write(data)
+		writer.WriteByte('\n')
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// alertEvent alert.follow 推送的事件（每行一个）
+type alertEvent struct {
+	Event   string       `json:"event"` // alert | heartbeat
+	Ts      int64        `json:"ts,omitempty"`
+	Alert   *AlertRecord `json:"alert,omitempty"`
+	Dropped int64        `json:"dropped"`
+}
+
+// handleAlertFollow 持续推送新产生的告警（可按 rule/pkg 过滤），直到客户端断开或服务器停止
+func (s *Server) handleAlertFollow(conn net.Conn, reader *bufio.Reader, writer *bufio.Writer, params json.RawMessage) {
+	var req struct {
+		Rule      string `json:"rule"`
+		Pkg       string `json:"pkg"`
+		QueueSize int    `json:"queueSize"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			s.writeError(writer, "E_ARG", "Invalid parameters", "")
+			return
+		}
+	}
+	filter := AlertFilter{Rule: req.Rule, Pkg: req.Pkg}
+
+	alerts := s.daemon.logger.alerts
+	sub := alerts.Subscribe(req.QueueSize)
+	defer alerts.Unsubscribe(sub)
+
+	ack, _ := json.Marshal(Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"subscriptionId": sub.ID,
+			"queueSize":      cap(sub.ch),
+		},
+	})
+	writer.Write(ack)
+	writer.WriteByte('\n')
+	if err := writer.Flush(); err != nil {
+		return
+	}
+
+	// 客户端不再发送请求，读到 EOF 即视为断开
+	conn.SetReadDeadline(time.Time{})
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, err := reader.ReadString('\n'); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(followHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		var ev alertEvent
+		select {
+		case <-s.stopCh:
+			return
+		case <-closed:
+			return
+		case rec := <-sub.C():
+			if !filter.match(&rec) {
+				continue
+			}
+			ev = alertEvent{Event: "alert", Alert: &rec, Dropped: sub.Dropped()}
+		case <-heartbeat.C:
+			ev = alertEvent{Event: "heartbeat", Ts: time.Now().UnixMilli(), Dropped: sub.Dropped()}
+		}
+
+		data, _ := json.Marshal(ev)
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		writer.Write(data)
+		writer.WriteByte('\n')
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// exportEvent 流式导出时在确认响应之后发送的事件（每行一个）
+type exportEvent struct {
+	Event   string `json:"event"` // chunk | end
+	Seq     int    `json:"seq,omitempty"`
+	Data    []byte `json:"data,omitempty"` // base64
+	Entries int    `json:"entries,omitempty"`
+	Bytes   int64  `json:"bytes,omitempty"`
+}
+
+// handleLogExport 处理 log.export，返回 false 表示连接已不可用
+//
+// 指定 out 时写入日志目录下 exports/<out> 并返回一个响应；否则先返回确认响应，
+// 再以 chunk 事件分块发送导出内容，最后发送 end 事件。
+func (s *Server) handleLogExport(conn net.Conn, writer *bufio.Writer, params json.RawMessage) bool {
+	var req struct {
+		Pkg       string   `json:"pkg"`
+		From      int64    `json:"from"`
+		To        int64    `json:"to"`
+		Ops       []string `json:"ops"`
+		Decisions []string `json:"decisions"`
+		Contains  string   `json:"contains"`
+		Where     string   `json:"where"`
+		Format    string   `json:"format"`
+		Gzip      bool     `json:"gzip"`
+		Out       string   `json:"out"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			s.writeError(writer, "E_ARG", "Invalid parameters", "")
+			return true
+		}
+	}
+
+	opts := ExportOptions{Format: req.Format, Gzip: req.Gzip}
+	if err := opts.Validate(); err != nil {
+		s.writeError(writer, "E_ARG", err.Error(), "format")
+		return true
+	}
+
+	filter := LogFilter{
+		Pkg:       req.Pkg,
+		From:      req.From,
+		To:        req.To,
+		Ops:       req.Ops,
+		Decisions: req.Decisions,
+		Contains:  req.Contains,
+	}
+	if req.Where != "" {
+		where, err := ParseLogQuery(req.Where)
+		if err != nil {
+			s.writeError(writer, "E_ARG", "Invalid where expression: "+err.Error(), "where")
+			return true
+		}
+		filter.Where = where
+	}
+
+	if req.Out != "" && (req.Out != filepath.Base(req.Out) || req.Out == "." || req.Out == ".." || strings.HasSuffix(req.Out, ".tmp")) {
+		s.writeError(writer, "E_ARG", "out must be a file name in the export directory", "out")
+		return true
+	}
+
+	if req.Out != "" {
+		path, result, err := s.daemon.logger.ExportFile(req.Out, filter, opts)
+		var resp Response
+		if err != nil {
+			resp = Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_LOG_IO",
+					Message: err.Error(),
+					Field:   "out",
+				},
+			}
+		} else {
+			resp = Response{
+				Ok: true,
+				Data: map[string]interface{}{
+					"out":     path,
+					"format":  result.Format,
+					"gzip":    result.Gzip,
+					"entries": result.Entries,
+					"bytes":   result.Bytes,
+				},
+			}
+		}
+		data, _ := json.Marshal(resp)
+		writer.Write(data)
+		writer.WriteByte('\n')
+		return writer.Flush() == nil
+	}
+
+	f, result, err := s.daemon.logger.ExportTemp(filter, opts)
+	if err != nil {
+		s.writeError(writer, "E_LOG_IO", err.Error(), "")
+		return true
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	ack, _ := json.Marshal(Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"format":    result.Format,
+			"gzip":      result.Gzip,
+			"entries":   result.Entries,
+			"bytes":     result.Bytes,
+			"chunkSize": exportChunkSize,
+		},
+	})
+	writer.Write(ack)
+	writer.WriteByte('\n')
+
+	buf := make([]byte, exportChunkSize)
+	for seq := 1; ; seq++ {
+		n, err := io.ReadFull(f, buf)
+		if n > 0 {
+			data, _ := json.Marshal(exportEvent{Event: "chunk", Seq: seq, Data: buf[:n]})
+			conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			writer.Write(data)
+			writer.WriteByte('\n')
+			if werr := writer.Flush(); werr != nil {
+				return false
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			// 确认响应已发出，只能断开连接让客户端发现导出不完整
+			s.daemon.logger.Errorf("server", "Failed to stream log export: %v", err)
+			return false
+		}
+	}
+
+	data, _ := json.Marshal(exportEvent{Event: "end", Entries: result.Entries, Bytes: result.Bytes})
+	writer.Write(data)
+	writer.WriteByte('\n')
+	err = writer.Flush()
+	conn.SetWriteDeadline(time.Time{})
+	return err == nil
+}
+
+func (s *Server) handleDiagWhoami(params json.RawMessage) Response {
+	var req struct {
+		Pid int `json:"pid"`
+	}
+	json.Unmarshal(params, &req)
 
 	if req.Pid <= 0 {
 		req.Pid = os.Getpid()
 	}
 
-	// 简化实现，实际应该查询进程信息
+	info, err := s.daemon.procResolver.Resolve(req.Pid)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_NOT_FOUND",
+					Message: fmt.Sprintf("Process not found: %d", req.Pid),
+					Field:   "pid",
+				},
+			}
+		}
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_INTERNAL",
+				Message: err.Error(),
+			},
+		}
+	}
+
 	return Response{
 		Ok: true,
 		Data: map[string]interface{}{
-			"pid": req.Pid,
-			"uid": os.Getuid(),
+			"pid":       info.Pid,
+			"ppid":      info.PPid,
+			"uid":       info.Uid,
+			"userId":    info.UserId,
+			"proc":      info.Proc,
+			"seContext": info.SeContext,
+			"parent": map[string]interface{}{
+				"pid":  info.PPid,
+				"proc": info.ParentProc,
+				"uid":  info.ParentUid,
+			},
 			"resolved": map[string]interface{}{
-				"packageName":      "",
-				"isIsolated":       false,
-				"resolutionReason": "UNKNOWN",
+				"packageName":      info.PackageName,
+				"isIsolated":       info.IsIsolated,
+				"isAppZygote":      info.IsAppZygote,
+				"isAppZygoteChild": info.IsAppZygoteChild,
+				"isChildProcess":   info.IsChildProcess,
+				"resolutionReason": info.ResolutionReason,
 				"ruleSetVersion":   s.daemon.configManager.GetVersion(),
 			},
 		},
 	}
 }
 
+func (s *Server) handleProcAttribute(params json.RawMessage) Response {
+	var req struct {
+		Pid int  `json:"pid"`
+		Uid *int `json:"uid"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil || (req.Pid <= 0 && req.Uid == nil) {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Missing pid or uid parameter",
+			},
+		}
+	}
+
+	var result *Attribution
+	var err error
+	if req.Pid > 0 {
+		result, err = s.daemon.attributor.AttributePid(req.Pid)
+	} else {
+		result, err = s.daemon.attributor.AttributeUid(*req.Uid)
+	}
+	if err != nil {
+		if os.IsNotExist(err) {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_NOT_FOUND",
+					Message: fmt.Sprintf("Process not found: %d", req.Pid),
+					Field:   "pid",
+				},
+			}
+		}
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: err.Error(),
+			},
+		}
+	}
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"attribution": result,
+		},
+	}
+}
+
+func (s *Server) handleProcHello(params json.RawMessage, peer peerCred) Response {
+	var req struct {
+		Pid            int    `json:"pid"`
+		Uid            int    `json:"uid"`
+		Pkg            string `json:"pkg"`
+		Proc           string `json:"proc"`
+		RuleSetVersion int    `json:"ruleSetVersion"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil || req.Pid <= 0 || req.Pkg == "" {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Missing pid or pkg parameter",
+			},
+		}
+	}
+
+	// 以内核提供的对端凭据为准：非 root 进程只能以自己的 pid、uid 和所属应用注册
+	if !peer.actsFor(req.Pid) {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_PERMISSION",
+				Message: fmt.Sprintf("Caller pid %d cannot act for process %d", peer.Pid, req.Pid),
+				Field:   "pid",
+			},
+		}
+	}
+	if !peer.isRoot() {
+		if req.Uid != peer.Uid {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_PERMISSION",
+					Message: fmt.Sprintf("uid %d does not match caller uid %d", req.Uid, peer.Uid),
+					Field:   "uid",
+				},
+			}
+		}
+		if info, err := s.daemon.procResolver.Resolve(peer.Pid); err == nil && info.PackageName != "" && info.PackageName != req.Pkg {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_PERMISSION",
+					Message: fmt.Sprintf("Process %d belongs to %s, not %s", peer.Pid, info.PackageName, req.Pkg),
+					Field:   "pkg",
+				},
+			}
+		}
+	}
+
+	p := s.daemon.registry.Register(RuntimeProcess{
+		Pid:            req.Pid,
+		Uid:            req.Uid,
+		Pkg:            req.Pkg,
+		Proc:           req.Proc,
+		RuleSetVersion: req.RuleSetVersion,
+	})
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"process":             p,
+			"heartbeatIntervalMs": s.daemon.configManager.GetGlobalConfig().Update.PollIntervalMs,
+			"configVersion":       s.daemon.configManager.GetVersion(),
+		},
+	}
+}
+
+func (s *Server) handleProcHeartbeat(params json.RawMessage, peer peerCred) Response {
+	var req struct {
+		Pid            int `json:"pid"`
+		RuleSetVersion int `json:"ruleSetVersion"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil || req.Pid <= 0 {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Missing pid parameter",
+			},
+		}
+	}
+
+	if !peer.actsFor(req.Pid) {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_PERMISSION",
+				Message: fmt.Sprintf("Caller pid %d cannot act for process %d", peer.Pid, req.Pid),
+				Field:   "pid",
+			},
+		}
+	}
+
+	found, refresh := s.daemon.registry.Heartbeat(req.Pid, req.RuleSetVersion)
+	if !found {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_NOT_FOUND",
+				Message: fmt.Sprintf("Process not registered: %d", req.Pid),
+				Hint:    "send proc.hello first",
+			},
+		}
+	}
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"refresh":       refresh,
+			"configVersion": s.daemon.configManager.GetVersion(),
+		},
+	}
+}
+
+func (s *Server) handleProcApplied(params json.RawMessage, peer peerCred) Response {
+	var req struct {
+		Pid            int `json:"pid"`
+		RuleSetVersion int `json:"ruleSetVersion"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil || req.Pid <= 0 || req.RuleSetVersion <= 0 {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Missing pid or ruleSetVersion parameter",
+			},
+		}
+	}
+
+	if !peer.actsFor(req.Pid) {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_PERMISSION",
+				Message: fmt.Sprintf("Caller pid %d cannot act for process %d", peer.Pid, req.Pid),
+				Field:   "pid",
+			},
+		}
+	}
+
+	p, ok := s.daemon.registry.ReportApplied(req.Pid, req.RuleSetVersion)
+	if !ok {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_NOT_FOUND",
+				Message: fmt.Sprintf("Process not registered: %d", req.Pid),
+				Hint:    "send proc.hello first",
+			},
+		}
+	}
+
+	version := s.daemon.configManager.GetVersion()
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"process":       p,
+			"current":       p.RuleSetVersion >= version,
+			"configVersion": version,
+		},
+	}
+}
+
+func (s *Server) handleProcRefresh(params json.RawMessage, peer peerCred) Response {
+	var req struct {
+		Pid int    `json:"pid"`
+		Pkg string `json:"pkg"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &req); err != nil {
+			return Response{
+				Ok: false,
+				Error: &ErrorInfo{
+					Code:    "E_ARG",
+					Message: "Invalid parameters",
+				},
+			}
+		}
+	}
+
+	// 按应用或全部刷新只允许 root 客户端，其他进程只能刷新自己
+	if !peer.isRoot() && (req.Pid <= 0 || !peer.actsFor(req.Pid)) {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_PERMISSION",
+				Message: "proc.refresh of other processes requires a root client",
+				Field:   "pid",
+			},
+		}
+	}
+
+	pids := s.daemon.registry.RequestRefresh(req.Pid, req.Pkg)
+	if req.Pid > 0 && len(pids) == 0 {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_NOT_FOUND",
+				Message: fmt.Sprintf("Process not registered: %d", req.Pid),
+			},
+		}
+	}
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"signalled":     pids,
+			"configVersion": s.daemon.configManager.GetVersion(),
+		},
+	}
+}
+
+func (s *Server) handleRuntimeStale(params json.RawMessage) Response {
+	var req struct {
+		Pkg string `json:"pkg"`
+	}
+	if len(params) > 0 {
+		json.Unmarshal(params, &req)
+	}
+
+	window := time.Duration(s.daemon.configManager.GetGlobalConfig().Update.PollIntervalMs) * time.Millisecond
+	stale := s.daemon.registry.Stale(req.Pkg, window)
+
+	now := time.Now().UnixMilli()
+	processes := make([]map[string]interface{}, 0, len(stale))
+	for _, p := range stale {
+		processes = append(processes, map[string]interface{}{
+			"pid":            p.Pid,
+			"pkg":            p.Pkg,
+			"proc":           p.Proc,
+			"uid":            p.Uid,
+			"ruleSetVersion": p.RuleSetVersion,
+			"staleSince":     p.StaleSince,
+			"staleForMs":     now - p.StaleSince,
+			"refreshPending": p.RefreshPending,
+			"lastSeenAt":     p.LastSeenAt,
+		})
+	}
+
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"processes":     processes,
+			"windowMs":      window.Milliseconds(),
+			"configVersion": s.daemon.configManager.GetVersion(),
+		},
+	}
+}
+
+func (s *Server) handleProcBye(params json.RawMessage, peer peerCred) Response {
+	var req struct {
+		Pid int `json:"pid"`
+	}
+	if err := json.Unmarshal(params, &req); err != nil || req.Pid <= 0 {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_ARG",
+				Message: "Missing pid parameter",
+			},
+		}
+	}
+
+	if !peer.actsFor(req.Pid) {
+		return Response{
+			Ok: false,
+			Error: &ErrorInfo{
+				Code:    "E_PERMISSION",
+				Message: fmt.Sprintf("Caller pid %d cannot act for process %d", peer.Pid, req.Pid),
+				Field:   "pid",
+			},
+		}
+	}
+
+	s.daemon.registry.Unregister(req.Pid)
+	return Response{
+		Ok: true,
+	}
+}
+
+func (s *Server) handleProcList() Response {
+	return Response{
+		Ok: true,
+		Data: map[string]interface{}{
+			"processes":     s.daemon.registry.List(),
+			"configVersion": s.daemon.configManager.GetVersion(),
+		},
+	}
+}
+
 // parseInt 辅助函数
 func parseInt(s string) int {
 	i, _ := strconv.Atoi(s)
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxTrackedSessions 扫描时同时跟踪的未关闭会话数，超出后不再开始新会话
+const maxTrackedSessions = 10000
+
+// 参与会话拼接的操作
+var (
+	sessionOpenOps  = map[string]bool{"open": true, "openat": true, "creat": true}
+	sessionReadOps  = map[string]bool{"read": true, "pread": true, "readv": true}
+	sessionWriteOps = map[string]bool{"write": true, "pwrite": true, "writev": true}
+	sessionCloseOps = map[string]bool{"close": true}
+)
+
+// SessionSpec 会话筛选条件（作用于拼接后的会话）
+type SessionSpec struct {
+	PathPrefix string
+	OpenOnly   bool  // 只返回未关闭的会话
+	MinBytes   int64 // 读写字节数之和的下限
+}
+
+// FileSession 文件会话：一次打开到关闭之间对同一 fd 的读写
+type FileSession struct {
+	Pkg          string `json:"pkg"`
+	Proc         string `json:"proc,omitempty"`
+	Pid          int    `json:"pid"`
+	Fd           int    `json:"fd"` // 只有 openId 时为 -1
+	OpenID       int64  `json:"openId,omitempty"`
+	Path         string `json:"path"`
+	Mapped       string `json:"mapped,omitempty"`
+	Ino          uint64 `json:"ino,omitempty"`
+	Dev          uint64 `json:"dev,omitempty"`
+	Decision     string `json:"decision,omitempty"` // 打开时的决策
+	OpenTs       int64  `json:"openTs"`
+	CloseTs      int64  `json:"closeTs,omitempty"`
+	LastTs       int64  `json:"lastTs"`
+	DurationMs   int64  `json:"durationMs"` // 未关闭时计到最后一个事件
+	Closed       bool   `json:"closed"`
+	Partial      bool   `json:"partial,omitempty"` // 没有找到 open 事件（早于查询范围或已被删除）
+	Reads        int    `json:"reads"`
+	Writes       int    `json:"writes"`
+	BytesRead    int64  `json:"bytesRead"`
+	BytesWritten int64  `json:"bytesWritten"`
+	Errors       int    `json:"errors,omitempty"` // errno 非 0 的操作数
+}
+
+// sessionKey 关联同一次打开的事件：有 openId 时按 openId，否则按进程与 fd
+func sessionKey(e *LogEntry) string {
+	if e.OpenID != 0 {
+		return e.Pkg + "\x00" + strconv.Itoa(e.Pid) + "\x00o" + strconv.FormatInt(e.OpenID, 10)
+	}
+	return e.Pkg + "\x00" + strconv.Itoa(e.Pid) + "\x00f" + strconv.Itoa(e.fd())
+}
+
+// match 判断会话是否满足筛选条件
+func (spec *SessionSpec) match(s *FileSession) bool {
+	if spec.PathPrefix != "" && !strings.HasPrefix(s.Path, spec.PathPrefix) {
+		return false
+	}
+	if spec.OpenOnly && s.Closed {
+		return false
+	}
+	return s.BytesRead+s.BytesWritten >= spec.MinBytes
+}
+
+// Sessions 按写入顺序扫描带 fd/openId 的条目，将 open→read/write→close 拼接为
+// 文件会话，返回按打开时间降序的会话与因跟踪数达到上限而未拼接的事件数
+//
+// filter 作用于条目（应只包含 pkg 与时间范围，避免拆散会话），spec 作用于会话。
+// 没有 close 的会话在 fd 被新的 open 复用或扫描结束时视为未关闭。
+func (l *Logger) Sessions(filter LogFilter, spec SessionSpec) ([]FileSession, int, error) {
+	l.Flush()
+
+	var done []*FileSession
+	open := make(map[string]*FileSession)
+	dropped := 0
+	err := l.store.Scan(&filter, func(e *LogEntry) bool {
+		if e.Fd == nil && e.OpenID == 0 {
+			return true
+		}
+		n := e.events()
+		failed := e.Errno != nil && *e.Errno != 0
+		key := sessionKey(e)
+
+		s := open[key]
+		if sessionOpenOps[e.Op] {
+			if failed {
+				return true
+			}
+			if s != nil {
+				done = append(done, s)
+				delete(open, key)
+			}
+			s = nil
+		}
+		if s == nil {
+			if len(open) >= maxTrackedSessions {
+				dropped += n
+				return true
+			}
+			s = &FileSession{
+				Pkg:      e.Pkg,
+				Proc:     e.Proc,
+				Pid:      e.Pid,
+				Fd:       e.fd(),
+				OpenID:   e.OpenID,
+				Path:     e.Path,
+				Mapped:   e.Mapped,
+				OpenTs:   e.Ts,
+				Partial:  !sessionOpenOps[e.Op],
+				Decision: e.Decision,
+			}
+			if s.Partial {
+				s.Decision = ""
+			}
+			open[key] = s
+		}
+
+		s.LastTs = max(s.LastTs, e.Ts, e.LastTs)
+		if s.Ino == 0 {
+			s.Ino, s.Dev = e.Ino, e.Dev
+		}
+		if s.Path == "" {
+			s.Path = e.Path
+		}
+		if failed {
+			s.Errors += n
+		}
+		switch {
+		case sessionReadOps[e.Op]:
+			s.Reads += n
+			s.BytesRead += e.Bytes
+		case sessionWriteOps[e.Op]:
+			s.Writes += n
+			s.BytesWritten += e.Bytes
+		case sessionCloseOps[e.Op]:
+			s.Closed = true
+			s.CloseTs = e.Ts
+			done = append(done, s)
+			delete(open, key)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, s := range open {
+		done = append(done, s)
+	}
+
+	result := make([]FileSession, 0, len(done))
+	for _, s := range done {
+		end := s.LastTs
+		if s.Closed {
+			end = s.CloseTs
+		}
+		s.DurationMs = end - s.OpenTs
+		if spec.match(s) {
+			result = append(result, *s)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].OpenTs != result[j].OpenTs {
+			return result[i].OpenTs > result[j].OpenTs
+		}
+		return result[i].Pid < result[j].Pid
+	})
+	return result, dropped, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// LogThrottleConfig 访问日志去重与限流配置，字段为 0 表示关闭对应功能
+type LogThrottleConfig struct {
+	DedupWindowMs int `json:"dedupWindowMs"` // 窗口内相同事件合并为一条
+	RatePerSec    int `json:"ratePerSec"`    // 每个应用每秒允许写入的条目数
+	Burst         int `json:"burst"`         // 令牌桶容量，为 0 时等于 ratePerSec
+}
+
+func validateLogThrottle(t *LogThrottleConfig) error {
+	if t.DedupWindowMs < 0 || t.DedupWindowMs > 60000 {
+		return fmt.Errorf("logThrottle.dedupWindowMs must be between 0 and 60000")
+	}
+	if t.RatePerSec < 0 || t.Burst < 0 {
+		return fmt.Errorf("logThrottle.ratePerSec/burst must not be negative")
+	}
+	if t.RatePerSec > 0 && t.Burst > 0 && t.Burst < t.RatePerSec {
+		return fmt.Errorf("logThrottle.burst must not be less than ratePerSec")
+	}
+	return nil
+}
+
+// tokenBucket 单个应用的令牌桶，以及被限流丢弃的事件汇总
+type tokenBucket struct {
+	tokens     float64
+	last       time.Time
+	suppressed int
+	firstTs    int64
+	lastTs     int64
+	decisions  map[string]int
+}
+
+// logThrottle Logger 的去重与限流状态（由 Logger.mu 保护）
+//
+// 去重只在缓冲区内进行：相同事件的首条进入缓冲区，窗口内的后续事件
+// 只累加首条的 count 与 lastTs，缓冲区刷新后重新开始。
+type logThrottle struct {
+	cfg     LogThrottleConfig
+	dedup   map[string]int // 事件键 -> 缓冲区下标
+	buckets map[string]*tokenBucket
+
+	deduplicated int64
+	suppressed   int64
+}
+
+func newLogThrottle() logThrottle {
+	return logThrottle{
+		dedup:   make(map[string]int),
+		buckets: make(map[string]*tokenBucket),
+	}
+}
+
+// dedupKey 判断两个事件是否相同的键
+func dedupKey(e *LogEntry) string {
+	// 不同打开的事件不合并，避免文件会话的读写计数串到一起
+	return e.Pkg + "\x00" + strconv.Itoa(e.Pid) + "\x00" + e.Op + "\x00" + e.Path + "\x00" + e.Decision + "\x00" + e.Result +
+		"\x00" + strconv.Itoa(e.fd()) + "\x00" + strconv.FormatInt(e.OpenID, 10)
+}
+
+// mergeDuplicateLocked 将事件合并到缓冲区中窗口内的相同事件，成功时返回 true
+func (l *Logger) mergeDuplicateLocked(entry *LogEntry) bool {
+	window := int64(l.throttle.cfg.DedupWindowMs)
+	if window <= 0 {
+		return false
+	}
+
+	idx, ok := l.throttle.dedup[dedupKey(entry)]
+	if !ok || idx >= len(l.buffer) {
+		return false
+	}
+	first := &l.buffer[idx]
+	firstTs := first.Ts
+	if first.Count > 0 {
+		firstTs = first.FirstTs
+	}
+	if entry.Ts-firstTs >= window || firstTs-entry.Ts >= window {
+		return false
+	}
+
+	if first.Count == 0 {
+		first.Count = 1
+		first.FirstTs = first.Ts
+		first.LastTs = first.Ts
+	}
+	first.Count++
+	first.Bytes += entry.Bytes
+	if entry.Ts > first.LastTs {
+		first.LastTs = entry.Ts
+	}
+	if entry.Ts < first.FirstTs {
+		first.FirstTs = entry.Ts
+	}
+	l.throttle.deduplicated++
+	return true
+}
+
+// allowLocked 从应用的令牌桶中取一个令牌，取不到时记入汇总并返回 false
+//
+// 拒绝事件不受限流影响，也不消耗令牌，避免被大量普通事件挤掉。
+func (l *Logger) allowLocked(entry *LogEntry, now time.Time) bool {
+	cfg := l.throttle.cfg
+	if cfg.RatePerSec <= 0 || isDenyDecision(entry.Decision) {
+		return true
+	}
+	burst := float64(cfg.Burst)
+	if burst == 0 {
+		burst = float64(cfg.RatePerSec)
+	}
+
+	b, ok := l.throttle.buckets[entry.Pkg]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.throttle.buckets[entry.Pkg] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * float64(cfg.RatePerSec)
+	if b.tokens > burst {
+		b.tokens = burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+
+	if b.suppressed == 0 {
+		b.firstTs = entry.Ts
+		b.decisions = make(map[string]int)
+	}
+	b.suppressed++
+	b.lastTs = entry.Ts
+	b.decisions[entry.Decision]++
+	l.throttle.suppressed++
+	return false
+}
+
+// takeSummaryLocked 取出应用被限流事件的汇总条目，没有被丢弃的事件时返回 nil
+func (l *Logger) takeSummaryLocked(pkg string) *LogEntry {
+	b, ok := l.throttle.buckets[pkg]
+	if !ok || b.suppressed == 0 {
+		return nil
+	}
+
+	summary := &LogEntry{
+		Ts:      b.lastTs,
+		Pkg:     pkg,
+		Op:      "suppressed",
+		Result:  "SUPPRESSED",
+		Count:   b.suppressed,
+		FirstTs: b.firstTs,
+		LastTs:  b.lastTs,
+		Extra: map[string]interface{}{
+			"message":   fmt.Sprintf("suppressed %d events", b.suppressed),
+			"decisions": b.decisions,
+		},
+	}
+	b.suppressed = 0
+	b.decisions = nil
+	return summary
+}
+
+// takeAllSummariesLocked 取出所有应用的限流汇总条目
+func (l *Logger) takeAllSummariesLocked() []*LogEntry {
+	var summaries []*LogEntry
+	for pkg := range l.throttle.buckets {
+		if s := l.takeSummaryLocked(pkg); s != nil {
+			summaries = append(summaries, s)
+		}
+	}
+	return summaries
+}
+
+// SetThrottle 设置去重与限流参数
+func (l *Logger) SetThrottle(cfg LogThrottleConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if cfg.RatePerSec != l.throttle.cfg.RatePerSec || cfg.Burst != l.throttle.cfg.Burst {
+		// 令牌桶按新参数重新计算，已丢弃事件的汇总保留到下次刷新
+		for _, b := range l.throttle.buckets {
+			b.tokens = float64(cfg.Burst)
+			if cfg.Burst == 0 {
+				b.tokens = float64(cfg.RatePerSec)
+			}
+		}
+	}
+	l.throttle.cfg = cfg
+}
@@ -10,6 +10,8 @@
 namespace StorageRedirect {
 
 static const char *APPS_CONFIG_DIR = "/data/adb/modules/StorageRedirect/config/apps";
+// 守护进程写入的实际生效配置（已应用生效时间与临时覆盖），存在时优先于 apps
+static const char *EFFECTIVE_CONFIG_DIR = "/data/adb/modules/StorageRedirect/config/effective";
 static const char *MONITOR_CONFIG_PATH = "/data/adb/modules/StorageRedirect/config/monitor_paths.json";
 static const char *GLOBAL_CONFIG_PATH = "/data/adb/modules/StorageRedirect/config/global.json";
 
@@ -131,7 +133,10 @@ void Config::loadMonitorConfig() {
 void Config::loadAllAppConfigs() {
     m_appConfigs.clear();
     
-    DIR *dir = opendir(APPS_CONFIG_DIR);
+    DIR *dir = opendir(EFFECTIVE_CONFIG_DIR);
+    if (!dir) {
+        dir = opendir(APPS_CONFIG_DIR);
+    }
     if (!dir) {
         LOGD("Apps config dir not found: %s", APPS_CONFIG_DIR);
         return;
@@ -168,9 +173,13 @@ void Config::loadAllAppConfigs() {
 }
 
 bool Config::loadAppConfig(const std::string &pkg, AppConfig &config) {
-    std::string path = std::string(APPS_CONFIG_DIR) + "/" + pkg + ".json";
+    std::string path = std::string(EFFECTIVE_CONFIG_DIR) + "/" + pkg + ".json";
     std::ifstream file(path);
     
+    if (!file.is_open()) {
+        path = std::string(APPS_CONFIG_DIR) + "/" + pkg + ".json";
+        file.open(path);
+    }
     if (!file.is_open()) {
         return false;
     }